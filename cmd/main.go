@@ -1,12 +1,23 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	database "med-manager/database"
+	"med-manager/domain/response"
+	"med-manager/jobs"
+	models "med-manager/models"
 	routes "med-manager/routes"
+	"med-manager/utils/notify"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"gorm.io/gorm"
 )
 
 func main() {
@@ -16,6 +27,15 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// The store's GSTIN tells purchases from other states apart
+	models.StoreGSTIN = os.Getenv("STORE_GSTIN")
+
+	// Run a subcommand instead of the server, if one is given
+	if len(os.Args) > 1 {
+		runCommand(db, os.Args[1], os.Args[2:])
+		return
+	}
+
 	// Create Fiber app
 	app := fiber.New()
 
@@ -25,6 +45,99 @@ func main() {
 	// Setup routes
 	routes.SetupRoutes(app, db)
 
+	// Start background jobs
+	jobs.StartExpiryAlerts(db, 6*time.Hour, models.DefaultExpiryWindowDays)
+	jobs.StartAlertNotifications(db, alertChannels(), time.Minute)
+
 	// Start server
 	log.Fatal(app.Listen(":3000"))
 }
+
+// alertChannels always log alerts, and also post them to ALERT_WEBHOOK_URL and mail them
+// to ALERT_EMAIL_TO (comma separated) through the SMTP server at ALERT_SMTP_ADDR when those are set.
+func alertChannels() []notify.Channel {
+	channels := []notify.Channel{{Name: "log", Notifier: notify.LogNotifier{}}}
+
+	if url := os.Getenv("ALERT_WEBHOOK_URL"); url != "" {
+		channels = append(channels, notify.Channel{Name: "webhook", Notifier: notify.NewWebhookNotifier(url)})
+	}
+
+	if to := os.Getenv("ALERT_EMAIL_TO"); to != "" {
+		addr := os.Getenv("ALERT_SMTP_ADDR")
+		if addr == "" {
+			addr = "localhost:1025"
+		}
+		from := os.Getenv("ALERT_EMAIL_FROM")
+		if from == "" {
+			from = "alerts@med-manager.local"
+		}
+		channels = append(channels, notify.Channel{Name: "email", Notifier: &notify.EmailNotifier{Addr: addr, From: from, To: strings.Split(to, ",")}})
+	}
+
+	return channels
+}
+
+func runCommand(db *gorm.DB, command string, args []string) {
+	switch command {
+	case "check-stock":
+		checkStock(db, args)
+	case "load-icd10":
+		loadICD10(db, args)
+	default:
+		log.Fatalf("Unknown command %q, available commands: check-stock, load-icd10", command)
+	}
+}
+
+// loadICD10 loads the ICD-10 code table visit diagnoses are coded from, from a code,description CSV file.
+func loadICD10(db *gorm.DB, args []string) {
+	flags := flag.NewFlagSet("load-icd10", flag.ExitOnError)
+	file := flags.String("file", "icd10.csv", "CSV file of code,description rows")
+	flags.Parse(args)
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("Failed to open ICD-10 codes: %v", err)
+	}
+	defer f.Close()
+
+	count, err := models.LoadICD10Codes(db, f)
+	if err != nil {
+		log.Fatalf("Failed to load ICD-10 codes: %v", err)
+	}
+	fmt.Printf("Loaded %d ICD-10 codes\n", count)
+}
+
+// checkStock reports medicines whose current stock disagrees with the ledger and, with -repair, fixes them.
+func checkStock(db *gorm.DB, args []string) {
+	flags := flag.NewFlagSet("check-stock", flag.ExitOnError)
+	repair := flags.Bool("repair", false, "set the current stock of inconsistent medicines to their ledger stock")
+	reason := flags.String("reason", "stock rebuild from cli", "reason recorded in the stock audit when repairing")
+	flags.Parse(args)
+
+	var discrepancies []response.StockDiscrepancy
+	var err error
+	if *repair {
+		discrepancies, err = models.RepairStockConsistency(db, "cli", *reason)
+	} else {
+		discrepancies, err = models.CheckStockConsistency(db)
+	}
+	if err != nil {
+		log.Fatalf("Failed to check stock: %v", err)
+	}
+
+	if len(discrepancies) == 0 {
+		fmt.Println("Stock is consistent with the ledger")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tMEDICINE\tCURRENT\tLEDGER\tLOTS\tREPAIRED")
+	for _, d := range discrepancies {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\t%t\n", d.MedicineID, d.Medicine, d.CurrentStock, d.LedgerStock, d.LotStock, d.Repaired)
+	}
+	w.Flush()
+
+	if !*repair {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"med-manager/domain/request"
+	respcode "med-manager/domain/respcodes"
+	"med-manager/domain/response"
+	"med-manager/models"
+	"med-manager/utils/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type AlertController struct {
+	DB *gorm.DB
+}
+
+func NewAlertController(db *gorm.DB) *AlertController {
+	return &AlertController{DB: db}
+}
+
+func (c *AlertController) GetAlerts(ctx *fiber.Ctx) error {
+	req := new(request.AlertListRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+	page, limit := pagination(req.Page, req.Limit)
+
+	alerts, err := models.GetAlerts(c.DB, req.Type, req.Status, (page-1)*limit, limit)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, alerts)
+}
+
+func (c *AlertController) AcknowledgeAlert(ctx *fiber.Ctx) error {
+	req := new(request.AcknowledgeAlertRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, req); !ok {
+		return errResponse
+	}
+
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	if err := models.AcknowledgeAlert(c.DB, id, req.AcknowledgedBy); err != nil {
+		if err == models.ErrAlreadyAcknowledged {
+			return response.CreateError(ctx, 400, respcode.ALREADY_ACKNOWLEDGED, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	alert, err := models.GetAlertByID(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, alert)
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"med-manager/domain/request"
+	respcode "med-manager/domain/respcodes"
+	"med-manager/domain/response"
+	"med-manager/models"
+	"med-manager/utils/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type InvoiceController struct {
+	DB *gorm.DB
+}
+
+func NewInvoiceController(db *gorm.DB) *InvoiceController {
+	return &InvoiceController{DB: db}
+}
+
+func invoiceErrorResponse(ctx *fiber.Ctx, err error) error {
+	switch err {
+	case models.ErrNotASale, models.ErrAlreadyInvoiced, models.ErrInvoiceNotDraft, models.ErrInvoiceCancelled,
+		models.ErrNotInInvoice, models.ErrInvoiceSourceUnset, models.ErrInvoicePaid:
+		return response.CreateError(ctx, 400, respcode.INVALID_INVOICE, err)
+	case models.ErrAlreadyVoided, models.ErrReversalNotVoidable, models.ErrTransferNotVoidable:
+		return response.CreateError(ctx, 400, respcode.ENTRY_NOT_VOIDABLE, err)
+	case models.ErrNothingToDispense:
+		return response.CreateError(ctx, 400, respcode.NOTHING_TO_DISPENSE, err)
+	case models.ErrUnknownLocation:
+		return response.CreateError(ctx, 400, respcode.INVALID_LOCATION, err)
+	}
+	return response.DBErrorResponse(ctx, err)
+}
+
+func (c *InvoiceController) CreateInvoice(ctx *fiber.Ctx) error {
+	invoiceReq := new(models.InvoiceRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, invoiceReq); !ok {
+		return errResponse
+	}
+
+	invoice, err, insufficientMedID := models.CreateInvoice(c.DB, invoiceReq)
+	if err != nil {
+		if err == models.ErrInsufficientStock || err == models.ErrOnlyExpiredStock {
+			return insufficientStockResponse(ctx, err, insufficientMedID)
+		}
+		return invoiceErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, invoice)
+}
+
+func (c *InvoiceController) GetAllInvoices(ctx *fiber.Ctx) error {
+	req := new(request.InvoiceListRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+	page, limit := pagination(req.Page, req.Limit)
+
+	invoices, err := models.GetAllInvoices(c.DB, req.Status, req.PatientID, (page-1)*limit, limit)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, invoices)
+}
+
+func (c *InvoiceController) GetInvoice(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+	invoice, err := models.GetInvoiceByID(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, invoice)
+}
+
+func (c *InvoiceController) UpdateInvoice(ctx *fiber.Ctx) error {
+	chargesReq := new(models.InvoiceChargesRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, chargesReq); !ok {
+		return errResponse
+	}
+
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	invoice, err := models.UpdateInvoiceCharges(c.DB, id, chargesReq)
+	if err != nil {
+		return invoiceErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, invoice)
+}
+
+func (c *InvoiceController) IssueInvoice(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	invoice, err := models.IssueInvoice(c.DB, id)
+	if err != nil {
+		return invoiceErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, invoice)
+}
+
+func (c *InvoiceController) CancelInvoice(ctx *fiber.Ctx) error {
+	cancelReq := new(request.CancelInvoiceRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, cancelReq); !ok {
+		return errResponse
+	}
+
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	invoice, err := models.CancelInvoice(c.DB, id, cancelReq.Reason, cancelReq.CancelledBy)
+	if err != nil {
+		if err == models.ErrInsufficientStock {
+			return response.CreateError(ctx, 400, respcode.INSUFFICIENT_STOCK, err)
+		}
+		return invoiceErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, invoice)
+}
+
+func (c *InvoiceController) GetTaxSummary(ctx *fiber.Ctx) error {
+	req := new(request.TaxSummaryRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+
+	summary, err := models.GetTaxSummary(c.DB, req.MonthStart())
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, summary)
+}
+
+func (c *InvoiceController) GetPatientInvoices(ctx *fiber.Ctx) error {
+	req := new(request.InvoiceListRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+	page, limit := pagination(req.Page, req.Limit)
+
+	patientID, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+	if _, err := models.GetPatientByID(c.DB, patientID); err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	invoices, err := models.GetAllInvoices(c.DB, req.Status, patientID, (page-1)*limit, limit)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, invoices)
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"med-manager/domain/request"
+	respcode "med-manager/domain/respcodes"
+	"med-manager/domain/response"
+	"med-manager/models"
+	"med-manager/utils/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type LocationController struct {
+	DB *gorm.DB
+}
+
+func NewLocationController(db *gorm.DB) *LocationController {
+	return &LocationController{DB: db}
+}
+
+func (c *LocationController) CreateLocation(ctx *fiber.Ctx) error {
+	locationReq := new(request.LocationRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, locationReq); !ok {
+		return errResponse
+	}
+
+	location := locationReq.ToLocation()
+	if err := location.Create(c.DB); err != nil {
+		if err == models.ErrUniqueNameViolation {
+			return response.CreateError(ctx, 400, respcode.DUPLICATE_NAME, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, location)
+}
+
+func (c *LocationController) GetAllLocations(ctx *fiber.Ctx) error {
+	locations, err := models.GetAllLocations(c.DB)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, locations)
+}
+
+func (c *LocationController) GetLocation(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+	location, err := models.GetLocationByID(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, location)
+}
+
+func (c *LocationController) UpdateLocation(ctx *fiber.Ctx) error {
+	locationReq := new(request.LocationRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, locationReq); !ok {
+		return errResponse
+	}
+
+	location := locationReq.ToLocation()
+	var err error
+	location.ID, err = ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	if err := location.Update(c.DB); err != nil {
+		if err == models.ErrUniqueNameViolation {
+			return response.CreateError(ctx, 400, respcode.DUPLICATE_NAME, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, location)
+}
+
+func (c *LocationController) GetLocationStock(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+	if _, err := models.GetLocationByID(c.DB, id); err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	stock, err := models.GetLocationStock(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, stock)
+}
+
+func (c *LocationController) TransferStock(ctx *fiber.Ctx) error {
+	transferReq := new(models.StockTransferRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, transferReq); !ok {
+		return errResponse
+	}
+
+	transfer, err, insufficientMedID := models.TransferStock(c.DB, transferReq)
+	if err != nil {
+		switch err {
+		case models.ErrInsufficientStock, models.ErrOnlyExpiredStock:
+			return insufficientStockResponse(ctx, err, insufficientMedID)
+		case models.ErrSameLocation, models.ErrUnknownLocation:
+			return response.CreateError(ctx, 400, respcode.INVALID_LOCATION, err)
+		case models.ErrUnknownUnit:
+			return response.CreateError(ctx, 400, respcode.INVALID_UNIT, err)
+		case models.ErrBatchExpiryMismatch:
+			return response.CreateError(ctx, 400, respcode.INVALID_BATCH, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, transfer)
+}
+
+func (c *LocationController) GetAllStockTransfers(ctx *fiber.Ctx) error {
+	req := new(request.StockTransferListRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+	page, limit := pagination(req.Page, req.Limit)
+
+	transfers, err := models.GetAllStockTransfers(c.DB, req.LocationID, (page-1)*limit, limit)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, transfers)
+}
+
+func (c *LocationController) GetStockTransfer(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+	transfer, err := models.GetStockTransferByID(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, transfer)
+}
@@ -31,6 +31,15 @@ func (c *MedicineController) CreateMedicine(ctx *fiber.Ctx) error {
 		if err == models.ErrUniqueNameViolation {
 			return response.CreateError(ctx, 400, respcode.DUPLICATE_NAME, err)
 		}
+		if err == models.ErrInvalidUnits {
+			return response.CreateError(ctx, 400, respcode.INVALID_UNIT, err)
+		}
+		if err == models.ErrInvalidTaxRate {
+			return response.CreateError(ctx, 400, respcode.INVALID_TAX_RATE, err)
+		}
+		if err == models.ErrPriceAboveMRP {
+			return response.CreateError(ctx, 400, respcode.INVALID_PRICE, err)
+		}
 		return response.DBErrorResponse(ctx, err)
 	}
 
@@ -75,12 +84,59 @@ func (c *MedicineController) UpdateMedicine(ctx *fiber.Ctx) error {
 		if err == models.ErrUniqueNameViolation {
 			return response.CreateError(ctx, 400, respcode.DUPLICATE_NAME, err)
 		}
+		if err == models.ErrInvalidUnits {
+			return response.CreateError(ctx, 400, respcode.INVALID_UNIT, err)
+		}
+		if err == models.ErrInvalidTaxRate {
+			return response.CreateError(ctx, 400, respcode.INVALID_TAX_RATE, err)
+		}
+		if err == models.ErrPriceAboveMRP {
+			return response.CreateError(ctx, 400, respcode.INVALID_PRICE, err)
+		}
 		return response.DBErrorResponse(ctx, err)
 	}
 
 	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, medicine)
 }
 
+func (c *MedicineController) AddMedicinePrice(ctx *fiber.Ctx) error {
+	priceReq := new(request.MedicinePriceRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, priceReq); !ok {
+		return errResponse
+	}
+
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	price := priceReq.ToMedicinePrice(id)
+	if err := models.AddMedicinePrice(c.DB, price); err != nil {
+		if err == models.ErrPriceAboveMRP || err == models.ErrFuturePrice {
+			return response.CreateError(ctx, 400, respcode.INVALID_PRICE, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, price)
+}
+
+func (c *MedicineController) GetMedicinePriceHistory(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+	if _, err := models.GetMedicineByID(c.DB, id); err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	prices, err := models.GetMedicinePriceHistory(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, prices)
+}
+
 func (c *MedicineController) DeleteMedicine(ctx *fiber.Ctx) error {
 	id, err := ctx.ParamsInt("id")
 	if err != nil {
@@ -122,6 +178,9 @@ func (c *MedicineController) CreateMedType(ctx *fiber.Ctx) error {
 	}
 
 	if err := medType.Create(c.DB); err != nil {
+		if err == models.ErrInvalidTaxRate {
+			return response.CreateError(ctx, 400, respcode.INVALID_TAX_RATE, err)
+		}
 		return response.DBErrorResponse(ctx, err)
 	}
 
@@ -141,6 +200,9 @@ func (c *MedicineController) UpdateMedType(ctx *fiber.Ctx) error {
 	}
 
 	if err := medType.Update(c.DB); err != nil {
+		if err == models.ErrInvalidTaxRate {
+			return response.CreateError(ctx, 400, respcode.INVALID_TAX_RATE, err)
+		}
 		return response.DBErrorResponse(ctx, err)
 	}
 
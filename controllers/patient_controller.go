@@ -29,14 +29,23 @@ func (c *PatientController) CreatePatient(ctx *fiber.Ctx) error {
 	if err := patient.Create(c.DB); err != nil {
 		return response.DBErrorResponse(ctx, err)
 	}
+	duplicates, err := models.FindDuplicatePatients(c.DB, patient)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	patient.PossibleDuplicates = duplicates
 
 	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, patient)
 }
 
 func (c *PatientController) GetAllPatients(ctx *fiber.Ctx) error {
-	page := ctx.QueryInt("page", 1)
-	limit := ctx.QueryInt("limit", 10)
-	patients, err := models.GetAllPatients(c.DB, (page-1)*limit, limit)
+	req := new(request.PatientListRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+	page, limit := pagination(req.Page, req.Limit)
+
+	patients, err := models.SearchPatients(c.DB, req.ToPatientSearch(), (page-1)*limit, limit)
 	if err != nil {
 		return response.DBErrorResponse(ctx, err)
 	}
@@ -52,6 +61,10 @@ func (c *PatientController) GetPatient(ctx *fiber.Ctx) error {
 	if err != nil {
 		return response.DBErrorResponse(ctx, err)
 	}
+	patient.OutstandingBalance, err = models.GetPatientOutstanding(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
 
 	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, patient)
 }
@@ -93,11 +106,55 @@ func (c *PatientController) UndoDeletePatient(ctx *fiber.Ctx) error {
 		return response.InvalidURLParamResponse(ctx, "id", err)
 	}
 	if err := models.UndoDeletePatient(c.DB, id); err != nil {
+		if err == models.ErrPatientMerged {
+			return response.CreateError(ctx, 400, respcode.PATIENT_MERGED, err)
+		}
 		return response.DBErrorResponse(ctx, err)
 	}
 	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, nil)
 }
 
+func (c *PatientController) MergePatient(ctx *fiber.Ctx) error {
+	mergeReq := new(request.PatientMergeRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, mergeReq); !ok {
+		return errResponse
+	}
+
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	survivor, err := models.MergePatients(c.DB, id, mergeReq.IntoPatientID, mergeReq.MergedBy)
+	if err != nil {
+		if err == models.ErrSelfMerge {
+			return response.CreateError(ctx, 400, respcode.PATIENT_MERGED, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, survivor)
+}
+
+func (c *PatientController) GetPatientHistory(ctx *fiber.Ctx) error {
+	dateRange := new(request.DateRange)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, dateRange); !ok {
+		return errResponse
+	}
+
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	from, to := dateRange.Bounds()
+	history, err := models.GetPatientHistory(c.DB, id, from, to)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, history)
+}
+
 func (c *PatientController) CreateVisit(ctx *fiber.Ctx) error {
 	VisitReq := new(request.VisitReq)
 	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, VisitReq); !ok {
@@ -106,6 +163,9 @@ func (c *PatientController) CreateVisit(ctx *fiber.Ctx) error {
 
 	visit := VisitReq.ToVisit()
 	if err := visit.Create(c.DB); err != nil {
+		if err == models.ErrUnknownICD10Code || err == models.ErrDiagnosisRequired {
+			return response.CreateError(ctx, 400, respcode.INVALID_DIAGNOSIS, err)
+		}
 		return response.DBErrorResponse(ctx, err)
 	}
 
@@ -148,6 +208,9 @@ func (c *PatientController) UpdateVisit(ctx *fiber.Ctx) error {
 		return response.InvalidURLParamResponse(ctx, "id", err)
 	}
 	if err := visit.Update(c.DB); err != nil {
+		if err == models.ErrUnknownICD10Code || err == models.ErrDiagnosisRequired {
+			return response.CreateError(ctx, 400, respcode.INVALID_DIAGNOSIS, err)
+		}
 		return response.DBErrorResponse(ctx, err)
 	}
 
@@ -166,9 +229,9 @@ func (c *PatientController) DeleteVisit(ctx *fiber.Ctx) error {
 }
 
 func (c *PatientController) GetAllVisitsByPatientID(ctx *fiber.Ctx) error {
-	patientID, err := ctx.ParamsInt("patient_id")
+	patientID, err := ctx.ParamsInt("id")
 	if err != nil {
-		return response.InvalidURLParamResponse(ctx, "patient_id", err)
+		return response.InvalidURLParamResponse(ctx, "id", err)
 	}
 	visits, err := models.GetAllVisitsByPatientID(c.DB, patientID)
 	if err != nil {
@@ -176,3 +239,119 @@ func (c *PatientController) GetAllVisitsByPatientID(ctx *fiber.Ctx) error {
 	}
 	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, visits)
 }
+
+func (c *PatientController) GetDiagnosedPatients(ctx *fiber.Ctx) error {
+	req := new(request.DiagnosisSearchRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+	page, limit := pagination(req.Page, req.Limit)
+
+	from, to := req.Bounds()
+	patients, err := models.GetDiagnosedPatients(c.DB, req.Q, req.Code, from, to, (page-1)*limit, limit)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, patients)
+}
+
+func (c *PatientController) SearchICD10Codes(ctx *fiber.Ctx) error {
+	req := new(request.ICD10CodeSearchRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+	page, limit := pagination(req.Page, req.Limit)
+
+	codes, err := models.SearchICD10Codes(c.DB, req.Q, (page-1)*limit, limit)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, codes)
+}
+
+func (c *PatientController) GetVisitPrescriptions(ctx *fiber.Ctx) error {
+	visitID, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+	prescriptions, err := models.GetPrescriptionsByVisitID(c.DB, visitID)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, prescriptions)
+}
+
+func (c *PatientController) UpdateVisitPrescriptions(ctx *fiber.Ctx) error {
+	prescriptionReq := new(request.PrescriptionRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, prescriptionReq); !ok {
+		return errResponse
+	}
+
+	visitID, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	prescriptions := prescriptionReq.ToPrescriptions()
+	if err, insufficientMedID := models.ReplaceVisitPrescriptions(c.DB, visitID, prescriptions, prescriptionReq.AllowExpired); err != nil {
+		if err == models.ErrInsufficientStock || err == models.ErrOnlyExpiredStock {
+			return insufficientStockResponse(ctx, err, insufficientMedID)
+		}
+		if err == models.ErrInvoicedEntry {
+			return response.CreateError(ctx, 400, respcode.ENTRY_NOT_VOIDABLE, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, prescriptions)
+}
+
+func (c *PatientController) DispenseVisitPrescriptions(ctx *fiber.Ctx) error {
+	dispenseReq := new(request.DispenseRequest)
+	if len(ctx.Body()) > 0 {
+		if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, dispenseReq); !ok {
+			return errResponse
+		}
+	}
+
+	visitID, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	deduction, err, insufficientMedID := models.DispenseVisitPrescriptions(c.DB, visitID, dispenseReq.LocationID, dispenseReq.AllowExpired)
+	if err != nil {
+		switch err {
+		case models.ErrInsufficientStock, models.ErrOnlyExpiredStock:
+			return insufficientStockResponse(ctx, err, insufficientMedID)
+		case models.ErrAlreadyDispensed:
+			return response.CreateError(ctx, 400, respcode.ALREADY_DISPENSED, err)
+		case models.ErrNothingToDispense:
+			return response.CreateError(ctx, 400, respcode.NOTHING_TO_DISPENSE, err)
+		case models.ErrUnknownLocation:
+			return response.CreateError(ctx, 400, respcode.INVALID_LOCATION, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, deduction)
+}
+
+func (c *PatientController) CancelVisitPrescriptions(ctx *fiber.Ctx) error {
+	visitID, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	if err := models.CancelVisitPrescriptions(c.DB, visitID); err != nil {
+		if err == models.ErrInsufficientStock {
+			return response.CreateError(ctx, 400, respcode.INSUFFICIENT_STOCK, err)
+		}
+		if err == models.ErrInvoicedEntry {
+			return response.CreateError(ctx, 400, respcode.ENTRY_NOT_VOIDABLE, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, nil)
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"med-manager/domain/request"
+	respcode "med-manager/domain/respcodes"
+	"med-manager/domain/response"
+	"med-manager/models"
+	"med-manager/utils/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type PaymentController struct {
+	DB *gorm.DB
+}
+
+func NewPaymentController(db *gorm.DB) *PaymentController {
+	return &PaymentController{DB: db}
+}
+
+func paymentErrorResponse(ctx *fiber.Ctx, err error) error {
+	switch err {
+	case models.ErrInvoiceNotIssued, models.ErrOverpayment, models.ErrNothingOutstanding, models.ErrPaymentVoided:
+		return response.CreateError(ctx, 400, respcode.INVALID_PAYMENT, err)
+	}
+	return response.DBErrorResponse(ctx, err)
+}
+
+func (c *PaymentController) RecordInvoicePayment(ctx *fiber.Ctx) error {
+	paymentReq := new(request.PaymentRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, paymentReq); !ok {
+		return errResponse
+	}
+
+	invoiceID, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	payment := paymentReq.ToPayment()
+	if err := models.RecordInvoicePayment(c.DB, invoiceID, payment); err != nil {
+		return paymentErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, payment)
+}
+
+func (c *PaymentController) GetInvoicePayments(ctx *fiber.Ctx) error {
+	invoiceID, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+	if _, err := models.GetInvoiceByID(c.DB, invoiceID); err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	payments, err := models.GetInvoicePayments(c.DB, invoiceID)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, payments)
+}
+
+func (c *PaymentController) RecordPatientPayment(ctx *fiber.Ctx) error {
+	paymentReq := new(request.PaymentRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, paymentReq); !ok {
+		return errResponse
+	}
+
+	patientID, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	payments, err := models.RecordPatientPayment(c.DB, patientID, paymentReq.ToPayment())
+	if err != nil {
+		return paymentErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, payments)
+}
+
+func (c *PaymentController) VoidPayment(ctx *fiber.Ctx) error {
+	voidReq := new(request.VoidPaymentRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, voidReq); !ok {
+		return errResponse
+	}
+
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	payment, err := models.VoidPayment(c.DB, id, voidReq.Reason, voidReq.VoidedBy)
+	if err != nil {
+		return paymentErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, payment)
+}
+
+func (c *PaymentController) GetPatientLedger(ctx *fiber.Ctx) error {
+	patientID, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+	if _, err := models.GetPatientByID(c.DB, patientID); err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	ledger, err := models.GetPatientLedger(c.DB, patientID)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, ledger)
+}
+
+func (c *PaymentController) GetDuesAgeing(ctx *fiber.Ctx) error {
+	ageing, err := models.GetDuesAgeing(c.DB)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, ageing)
+}
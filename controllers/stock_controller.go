@@ -1,10 +1,14 @@
 package controllers
 
 import (
+	"fmt"
+	"med-manager/domain/request"
 	respcode "med-manager/domain/respcodes"
 	"med-manager/domain/response"
 	models "med-manager/models"
+	"med-manager/utils/export"
 	"med-manager/utils/validation"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
@@ -42,19 +46,50 @@ func (c *StockController) UpdateStockUpdation(ctx *fiber.Ctx) error {
 		return response.InvalidURLParamResponse(ctx, "id", err)
 	}
 
-	if err := models.UpdateParticularsInAnStockUpdation(c.DB, stockUpdationID, stockUpdations.StockChanges); err != nil {
+	correctionID, err, insufficientMedID := models.UpdateParticularsInAnStockUpdation(c.DB, stockUpdationID, stockUpdations)
+	if err != nil {
+		switch err {
+		case models.ErrMissingBatchDetails, models.ErrBatchExpiryMismatch:
+			return response.CreateError(ctx, 400, respcode.INVALID_BATCH, err)
+		case models.ErrInsufficientStock, models.ErrOnlyExpiredStock:
+			return insufficientStockResponse(ctx, err, insufficientMedID)
+		case models.ErrAlreadyVoided, models.ErrReversalNotVoidable, models.ErrTransferNotVoidable, models.ErrInvoicedEntry:
+			return response.CreateError(ctx, 400, respcode.ENTRY_NOT_VOIDABLE, err)
+		case models.ErrNotInPurchaseOrder, models.ErrExceedsOutstanding:
+			return response.CreateError(ctx, 400, respcode.INVALID_PURCHASE_ORDER, err)
+		case models.ErrUnknownUnit:
+			return response.CreateError(ctx, 400, respcode.INVALID_UNIT, err)
+		}
 		return response.DBErrorResponse(ctx, err)
 	}
 
-	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, nil)
+	correction, err := models.GetStockUpdationByID(c.DB, correctionID)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, correction)
 }
 
 func (c *StockController) DeleteStockUpdation(ctx *fiber.Ctx) error {
+	voidReq := new(models.VoidStockUpdationRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, voidReq); !ok {
+		return errResponse
+	}
+
 	id, err := ctx.ParamsInt("id")
 	if err != nil {
 		return response.InvalidURLParamResponse(ctx, "id", err)
 	}
-	if err := models.DeleteStockUpdation(c.DB, id); err != nil {
+	if err := models.DeleteStockUpdation(c.DB, id, voidReq); err != nil {
+		switch err {
+		case models.ErrInsufficientStock:
+			return response.CreateError(ctx, 400, respcode.INSUFFICIENT_STOCK, err)
+		case models.ErrAlreadyVoided, models.ErrReversalNotVoidable, models.ErrTransferNotVoidable, models.ErrInvoicedEntry:
+			return response.CreateError(ctx, 400, respcode.ENTRY_NOT_VOIDABLE, err)
+		case models.ErrNotInPurchaseOrder:
+			return response.CreateError(ctx, 400, respcode.INVALID_PURCHASE_ORDER, err)
+		}
 		return response.DBErrorResponse(ctx, err)
 	}
 
@@ -62,12 +97,24 @@ func (c *StockController) DeleteStockUpdation(ctx *fiber.Ctx) error {
 }
 
 func (c *StockController) AddToStock(ctx *fiber.Ctx) error {
-	stockUpdationReq := new(models.StockUpdateRequest)
+	stockUpdationReq := new(models.StockAdditionRequest)
 	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, stockUpdationReq); !ok {
 		return errResponse
 	}
 
 	if err := stockUpdationReq.AddToStock(c.DB); err != nil {
+		if err == models.ErrMissingBatchDetails || err == models.ErrBatchExpiryMismatch {
+			return response.CreateError(ctx, 400, respcode.INVALID_BATCH, err)
+		}
+		if err == models.ErrInvalidMovementKind || err == models.ErrReasonRequired {
+			return movementKindErrorResponse(ctx, err)
+		}
+		if err == models.ErrUnknownUnit {
+			return response.CreateError(ctx, 400, respcode.INVALID_UNIT, err)
+		}
+		if err == models.ErrUnknownLocation {
+			return response.CreateError(ctx, 400, respcode.INVALID_LOCATION, err)
+		}
 		return response.DBErrorResponse(ctx, err)
 	}
 
@@ -75,10 +122,13 @@ func (c *StockController) AddToStock(ctx *fiber.Ctx) error {
 }
 
 func (c *StockController) GetAllStockAdditions(ctx *fiber.Ctx) error {
-	page := ctx.QueryInt("page", 1)
-	limit, err := ctx.ParamsInt("limit", 10)
+	listReq := new(models.StockUpdationListRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, listReq); !ok {
+		return errResponse
+	}
+	page, limit := pagination(listReq.Page, listReq.Limit)
 
-	stockAdditions, err := models.GetAllStockUpdations(c.DB, true, (page-1)*limit, limit)
+	stockAdditions, err := models.GetAllStockUpdations(c.DB, true, listReq.Kind, listReq.LocationID, (page-1)*limit, limit)
 	if err != nil {
 		return response.DBErrorResponse(ctx, err)
 	}
@@ -90,7 +140,7 @@ func (c *StockController) GetStockAdditionsByMedicineID(ctx *fiber.Ctx) error {
 	if err != nil {
 		return response.InvalidURLParamResponse(ctx, "medicine_id", err)
 	}
-	stockAdditions, err := models.GetStockUpdationParticularsByMedicineID(c.DB, medicineID, true)
+	stockAdditions, err := models.GetStockUpdationParticularsByMedicineID(c.DB, medicineID, true, ctx.Query("kind"))
 	if err != nil {
 		return response.DBErrorResponse(ctx, err)
 	}
@@ -104,29 +154,68 @@ func (c *StockController) DeductFromStock(ctx *fiber.Ctx) error {
 		return errResponse
 	}
 
-	if err, insufficientMedID := stockDeductions.DeductFromStock(c.DB); err != nil {
-		if err == models.ErrInsufficientStock {
-			return response.Response{
-				HttpStatusCode: 400,
-				Status:         false,
-				ResponseCode:   respcode.INSUFFICIENT_STOCK,
-				Error:          err,
-				Data: map[string]int{
-					"medicine_id": insufficientMedID,
-				},
-			}.WriteToJSON(ctx)
+	deduction, err, insufficientMedID := stockDeductions.DeductFromStock(c.DB)
+	if err != nil {
+		if err == models.ErrInsufficientStock || err == models.ErrOnlyExpiredStock {
+			return insufficientStockResponse(ctx, err, insufficientMedID)
+		}
+		if err == models.ErrInvalidMovementKind || err == models.ErrReasonRequired {
+			return movementKindErrorResponse(ctx, err)
+		}
+		if err == models.ErrUnknownUnit {
+			return response.CreateError(ctx, 400, respcode.INVALID_UNIT, err)
+		}
+		if err == models.ErrUnknownLocation {
+			return response.CreateError(ctx, 400, respcode.INVALID_LOCATION, err)
 		}
 		return response.DBErrorResponse(ctx, err)
 	}
 
-	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, nil)
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, deduction)
+}
+
+func movementKindErrorResponse(ctx *fiber.Ctx, err error) error {
+	if err == models.ErrReasonRequired {
+		return response.CreateError(ctx, 400, respcode.REASON_REQUIRED, err)
+	}
+	return response.CreateError(ctx, 400, respcode.INVALID_MOVEMENT_KIND, err)
+}
+
+// pagination defaults page to 1 and limit to 10 when not given.
+func pagination(page, limit int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
+	return page, limit
+}
+
+func insufficientStockResponse(ctx *fiber.Ctx, err error, insufficientMedID int) error {
+	respCode := respcode.INSUFFICIENT_STOCK
+	if err == models.ErrOnlyExpiredStock {
+		respCode = respcode.EXPIRED_STOCK
+	}
+	return response.Response{
+		HttpStatusCode: 400,
+		Status:         false,
+		ResponseCode:   respCode,
+		Error:          err,
+		Data: map[string]int{
+			"medicine_id": insufficientMedID,
+		},
+	}.WriteToJSON(ctx)
 }
 
 func (c *StockController) GetAllStockDeductions(ctx *fiber.Ctx) error {
-	page := ctx.QueryInt("page", 1)
-	limit, err := ctx.ParamsInt("limit", 10)
+	listReq := new(models.StockUpdationListRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, listReq); !ok {
+		return errResponse
+	}
+	page, limit := pagination(listReq.Page, listReq.Limit)
 
-	stockDeductions, err := models.GetAllStockUpdations(c.DB, false, (page-1)*limit, limit)
+	stockDeductions, err := models.GetAllStockUpdations(c.DB, false, listReq.Kind, listReq.LocationID, (page-1)*limit, limit)
 	if err != nil {
 		return response.DBErrorResponse(ctx, err)
 	}
@@ -138,7 +227,7 @@ func (c *StockController) GetStockDeductionsByMedicineID(ctx *fiber.Ctx) error {
 	if err != nil {
 		return response.InvalidURLParamResponse(ctx, "medicine_id", err)
 	}
-	stockDeductions, err := models.GetStockUpdationParticularsByMedicineID(c.DB, medicineID, false)
+	stockDeductions, err := models.GetStockUpdationParticularsByMedicineID(c.DB, medicineID, false, ctx.Query("kind"))
 	if err != nil {
 		return response.DBErrorResponse(ctx, err)
 	}
@@ -158,3 +247,340 @@ func (c *StockController) GetMedicineStockByMedicineID(ctx *fiber.Ctx) error {
 
 	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, stock)
 }
+
+func (c *StockController) GetStockLotsByMedicineID(ctx *fiber.Ctx) error {
+	medicineID, err := ctx.ParamsInt("medicine_id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "medicine_id", err)
+	}
+	lots, err := models.GetStockLotsByMedicineID(c.DB, medicineID, ctx.QueryInt("location_id", 0), ctx.QueryBool("include_empty", false))
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, lots)
+}
+
+func (c *StockController) GetReorderBill(ctx *fiber.Ctx) error {
+	req := new(request.ReorderBillRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+
+	bill, err := models.GetReorderBill(c.DB, req.Level)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	switch req.Format {
+	case "csv":
+		rows := [][]string{}
+		for _, group := range bill.Groups {
+			for _, item := range group.Items {
+				rows = append(rows, []string{
+					group.Type,
+					item.Medicine,
+					strconv.Itoa(item.Quantity),
+					item.QuantityInPacks,
+					strconv.Itoa(item.MinStock),
+					strconv.Itoa(item.OptimalStock),
+					strconv.Itoa(item.QuantityToBuy),
+					item.QuantityToBuyInPacks,
+					item.BaseUnit,
+					export.Amount(item.UnitPrice),
+					export.Amount(item.Value),
+				})
+			}
+			rows = append(rows, []string{group.Type, "Total", "", "", "", "", "", "", "", "", export.Amount(group.Total)})
+		}
+		rows = append(rows, []string{"", "Grand total", "", "", "", "", "", "", "", "", export.Amount(bill.GrandTotal)})
+		header := []string{"Type", "Medicine", "Current stock", "Current stock in packs", "Min stock", "Optimal stock", "Quantity to buy", "Quantity to buy in packs", "Base unit", "Unit price", "Value"}
+		return export.WriteCSV(ctx, "reorder_bill.csv", header, rows)
+	case "html":
+		return export.WriteHTML(ctx, reorderBillTemplate, bill)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, bill)
+}
+
+func (c *StockController) GetStockCard(ctx *fiber.Ctx) error {
+	req := new(request.StockCardRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+
+	medicineID, err := ctx.ParamsInt("medicine_id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "medicine_id", err)
+	}
+
+	from, to := req.Bounds()
+	card, err := models.GetStockCard(c.DB, medicineID, req.LocationID, from, to)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	if req.Format == "csv" {
+		rows := [][]string{{"", "", "Opening balance", "", "", "", strconv.Itoa(card.OpeningBalance), ""}}
+		for _, movement := range card.Movements {
+			reference := ""
+			if movement.ReferenceID != nil {
+				reference = strconv.Itoa(*movement.ReferenceID)
+			}
+			voided := ""
+			if movement.VoidedAt != nil {
+				voided = "voided"
+			}
+			rows = append(rows, []string{
+				movement.BroughtAt.Format("2006-01-02 15:04"),
+				strconv.Itoa(movement.StockUpdationID),
+				movement.EntryType,
+				reference,
+				strconv.Itoa(movement.In),
+				strconv.Itoa(movement.Out),
+				strconv.Itoa(movement.Balance),
+				voided,
+			})
+		}
+		rows = append(rows, []string{"", "", "Closing balance", "", "", "", strconv.Itoa(card.ClosingBalance), ""})
+		header := []string{"Date", "Stock updation", "Entry type", "Reference", "In", "Out", "Balance", "Status"}
+		return export.WriteCSV(ctx, fmt.Sprintf("stock_card_%d.csv", card.MedicineID), header, rows)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, card)
+}
+
+func (c *StockController) CheckStockConsistency(ctx *fiber.Ctx) error {
+	discrepancies, err := models.CheckStockConsistency(c.DB)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, discrepancies)
+}
+
+func (c *StockController) RepairStockConsistency(ctx *fiber.Ctx) error {
+	repairReq := new(request.StockRepairRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, repairReq); !ok {
+		return errResponse
+	}
+
+	discrepancies, err := models.RepairStockConsistency(c.DB, "api", repairReq.Reason)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, discrepancies)
+}
+
+func (c *StockController) GetStockAudits(ctx *fiber.Ctx) error {
+	page := ctx.QueryInt("page", 1)
+	limit := ctx.QueryInt("limit", 10)
+	audits, err := models.GetStockAudits(c.DB, (page-1)*limit, limit)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, audits)
+}
+
+func (c *StockController) StartStockTake(ctx *fiber.Ctx) error {
+	stockTakeReq := new(request.StockTakeRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, stockTakeReq); !ok {
+		return errResponse
+	}
+
+	stockTake := stockTakeReq.ToStockTake()
+	if err := stockTake.Create(c.DB); err != nil {
+		if err == models.ErrUnknownLocation {
+			return response.CreateError(ctx, 400, respcode.INVALID_LOCATION, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, stockTake)
+}
+
+func (c *StockController) GetAllStockTakes(ctx *fiber.Ctx) error {
+	page := ctx.QueryInt("page", 1)
+	limit := ctx.QueryInt("limit", 10)
+	stockTakes, err := models.GetAllStockTakes(c.DB, (page-1)*limit, limit)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, stockTakes)
+}
+
+func (c *StockController) GetStockTake(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+	report, err := models.GetStockTakeReport(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, report)
+}
+
+func (c *StockController) SubmitStockTakeCounts(ctx *fiber.Ctx) error {
+	countReq := new(request.StockTakeCountRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, countReq); !ok {
+		return errResponse
+	}
+
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	if err := models.SubmitStockTakeCounts(c.DB, id, countReq.ToStockTakeCounts()); err != nil {
+		if err == models.ErrStockTakeClosed {
+			return response.CreateError(ctx, 400, respcode.STOCK_TAKE_CLOSED, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	report, err := models.GetStockTakeReport(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, report)
+}
+
+func (c *StockController) FinaliseStockTake(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	if err, medicineID := models.FinaliseStockTake(c.DB, id); err != nil {
+		switch err {
+		case models.ErrStockTakeClosed:
+			return response.CreateError(ctx, 400, respcode.STOCK_TAKE_CLOSED, err)
+		case models.ErrInsufficientStock, models.ErrOnlyExpiredStock:
+			return insufficientStockResponse(ctx, err, medicineID)
+		case models.ErrNoLotForSurplus:
+			return response.Response{
+				HttpStatusCode: 400,
+				Status:         false,
+				ResponseCode:   respcode.NO_LOT_FOR_SURPLUS,
+				Error:          err,
+				Data: map[string]int{
+					"medicine_id": medicineID,
+				},
+			}.WriteToJSON(ctx)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	report, err := models.GetStockTakeReport(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, report)
+}
+
+func (c *StockController) CancelStockTake(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	if err := models.CancelStockTake(c.DB, id); err != nil {
+		if err == models.ErrStockTakeClosed {
+			return response.CreateError(ctx, 400, respcode.STOCK_TAKE_CLOSED, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, nil)
+}
+
+func (c *StockController) GetMovementSummary(ctx *fiber.Ctx) error {
+	dateRange := new(request.DateRange)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, dateRange); !ok {
+		return errResponse
+	}
+
+	from, to := dateRange.Bounds()
+	summary, err := models.GetMovementSummary(c.DB, from, to)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, summary)
+}
+
+func (c *StockController) GetStockValuation(ctx *fiber.Ctx) error {
+	req := new(request.StockValuationRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+
+	valuation, err := models.GetStockValuation(c.DB, req.Date())
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, valuation)
+}
+
+func (c *StockController) GetCostOfGoodsSold(ctx *fiber.Ctx) error {
+	dateRange := new(request.DateRange)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, dateRange); !ok {
+		return errResponse
+	}
+
+	from, to := dateRange.Bounds()
+	cogs, err := models.GetCostOfGoodsSold(c.DB, from, to)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, cogs)
+}
+
+func (c *StockController) GetExpiringStock(ctx *fiber.Ctx) error {
+	req := new(request.ExpiringStockRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+	withinDays, err := req.WithinDays()
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "within", err)
+	}
+
+	report, err := models.GetExpiringStock(c.DB, withinDays, req.LocationID)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, report)
+}
+
+func (c *StockController) GetExpiredStock(ctx *fiber.Ctx) error {
+	report, err := models.GetExpiredStock(c.DB, ctx.QueryInt("location_id", 0))
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, report)
+}
+
+func (c *StockController) GetReorderLevelSuggestions(ctx *fiber.Ctx) error {
+	req := new(request.ReorderLevelSuggestionRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+	req.Defaults()
+
+	suggestions, err := models.GetReorderLevelSuggestions(c.DB, req.Days, req.CoverDays, req.ServiceLevel)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, suggestions)
+}
+
+func (c *StockController) ApplyReorderLevels(ctx *fiber.Ctx) error {
+	req := new(request.ApplyReorderLevelsRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, req); !ok {
+		return errResponse
+	}
+
+	if err := models.ApplyReorderLevels(c.DB, req.ToReorderLevels()); err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, nil)
+}
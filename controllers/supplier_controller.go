@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"med-manager/domain/request"
+	respcode "med-manager/domain/respcodes"
+	"med-manager/domain/response"
+	"med-manager/models"
+	"med-manager/utils/validation"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type SupplierController struct {
+	DB *gorm.DB
+}
+
+func NewSupplierController(db *gorm.DB) *SupplierController {
+	return &SupplierController{DB: db}
+}
+
+func (c *SupplierController) CreateSupplier(ctx *fiber.Ctx) error {
+	supplierReq := new(request.SupplierRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, supplierReq); !ok {
+		return errResponse
+	}
+
+	supplier := supplierReq.ToSupplier()
+	if err := supplier.Create(c.DB); err != nil {
+		if err == models.ErrUniqueNameViolation {
+			return response.CreateError(ctx, 400, respcode.DUPLICATE_NAME, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, supplier)
+}
+
+func (c *SupplierController) GetAllSuppliers(ctx *fiber.Ctx) error {
+	suppliers, err := models.GetAllSuppliers(c.DB)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, suppliers)
+}
+
+func (c *SupplierController) GetSupplier(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+	supplier, err := models.GetSupplierByID(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, supplier)
+}
+
+func (c *SupplierController) UpdateSupplier(ctx *fiber.Ctx) error {
+	supplierReq := new(request.SupplierRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, supplierReq); !ok {
+		return errResponse
+	}
+
+	supplier := supplierReq.ToSupplier()
+	var err error
+	supplier.ID, err = ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	if err := supplier.Update(c.DB); err != nil {
+		if err == models.ErrUniqueNameViolation {
+			return response.CreateError(ctx, 400, respcode.DUPLICATE_NAME, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, supplier)
+}
+
+func (c *SupplierController) DeleteSupplier(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	if err := models.DeleteSupplier(c.DB, id); err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, nil)
+}
+
+func (c *SupplierController) CreatePurchaseOrder(ctx *fiber.Ctx) error {
+	purchaseOrderReq := new(request.PurchaseOrderRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, purchaseOrderReq); !ok {
+		return errResponse
+	}
+
+	purchaseOrder := purchaseOrderReq.ToPurchaseOrder()
+	if err := purchaseOrder.Create(c.DB); err != nil {
+		if err == models.ErrEmptyPurchaseOrder || err == models.ErrDuplicateOrderLines {
+			return response.CreateError(ctx, 400, respcode.INVALID_PURCHASE_ORDER, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, purchaseOrder)
+}
+
+func (c *SupplierController) GetAllPurchaseOrders(ctx *fiber.Ctx) error {
+	req := new(request.PurchaseOrderListRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+	page, limit := pagination(req.Page, req.Limit)
+
+	purchaseOrders, err := models.GetAllPurchaseOrders(c.DB, req.Status, req.SupplierID, (page-1)*limit, limit)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, purchaseOrders)
+}
+
+func (c *SupplierController) GetPurchaseOrder(ctx *fiber.Ctx) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+	purchaseOrder, err := models.GetPurchaseOrderByID(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, purchaseOrder)
+}
+
+func (c *SupplierController) PlacePurchaseOrder(ctx *fiber.Ctx) error {
+	return c.setPurchaseOrderStatus(ctx, models.PurchaseOrderOrdered)
+}
+
+func (c *SupplierController) CancelPurchaseOrder(ctx *fiber.Ctx) error {
+	return c.setPurchaseOrderStatus(ctx, models.PurchaseOrderCancelled)
+}
+
+func (c *SupplierController) setPurchaseOrderStatus(ctx *fiber.Ctx, status string) error {
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	if err := models.SetPurchaseOrderStatus(c.DB, id, status); err != nil {
+		if err == models.ErrPurchaseOrderState {
+			return response.CreateError(ctx, 400, respcode.INVALID_PURCHASE_ORDER, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 200, respcode.SUCCESS, nil)
+}
+
+func (c *SupplierController) ReceivePurchaseOrder(ctx *fiber.Ctx) error {
+	stockUpdationReq := new(models.StockAdditionRequest)
+	if ok, errResponse := validation.BindAndValidateJSONRequest(ctx, stockUpdationReq); !ok {
+		return errResponse
+	}
+
+	id, err := ctx.ParamsInt("id")
+	if err != nil {
+		return response.InvalidURLParamResponse(ctx, "id", err)
+	}
+
+	if err := models.ReceivePurchaseOrder(c.DB, id, stockUpdationReq); err != nil {
+		switch err {
+		case models.ErrPurchaseOrderState, models.ErrNotInPurchaseOrder, models.ErrExceedsOutstanding:
+			return response.CreateError(ctx, 400, respcode.INVALID_PURCHASE_ORDER, err)
+		case models.ErrMissingBatchDetails, models.ErrBatchExpiryMismatch:
+			return response.CreateError(ctx, 400, respcode.INVALID_BATCH, err)
+		case models.ErrUnknownUnit:
+			return response.CreateError(ctx, 400, respcode.INVALID_UNIT, err)
+		case models.ErrUnknownLocation:
+			return response.CreateError(ctx, 400, respcode.INVALID_LOCATION, err)
+		}
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	purchaseOrder, err := models.GetPurchaseOrderByID(c.DB, id)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, purchaseOrder)
+}
+
+func (c *SupplierController) CreatePurchaseOrdersFromReorderBill(ctx *fiber.Ctx) error {
+	req := new(request.ReorderBillRequest)
+	if ok, errResponse := validation.BindAndValidateURLQueryRequest(ctx, req); !ok {
+		return errResponse
+	}
+
+	drafts, err := models.CreatePurchaseOrdersFromReorderBill(c.DB, req.Level)
+	if err != nil {
+		return response.DBErrorResponse(ctx, err)
+	}
+
+	return response.CreateSuccess(ctx, 201, respcode.SUCCESS, drafts)
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"html/template"
+	"med-manager/utils/export"
+)
+
+var templateFuncs = template.FuncMap{
+	"amount": export.Amount,
+	"date":   func(t interface{ Format(string) string }) string { return t.Format("02 Jan 2006 15:04") },
+}
+
+var reorderBillTemplate = template.Must(template.New("reorder_bill").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Purchase Requisition</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 16px; }
+th, td { border: 1px solid #999; padding: 4px 6px; }
+td.num, th.num { text-align: right; }
+@media print { button { display: none; } }
+</style>
+</head>
+<body>
+<button onclick="window.print()">Print</button>
+<h2>Purchase Requisition</h2>
+<p>Generated at {{date .GeneratedAt}} &middot; medicines below {{.Level}} stock</p>
+{{range .Groups}}
+<h3>{{if .Type}}{{.Type}}{{else}}Uncategorised{{end}}</h3>
+<table>
+<tr><th>Medicine</th><th class="num">Current</th><th class="num">Min</th><th class="num">Optimal</th><th class="num">To buy</th><th>To buy in packs</th><th class="num">Unit price</th><th class="num">Value</th></tr>
+{{range .Items}}
+<tr><td>{{.Medicine}}</td><td class="num">{{.Quantity}} {{.BaseUnit}}<br>{{.QuantityInPacks}}</td><td class="num">{{.MinStock}}</td><td class="num">{{.OptimalStock}}</td><td class="num">{{.QuantityToBuy}}</td><td>{{.QuantityToBuyInPacks}}</td><td class="num">{{amount .UnitPrice}}</td><td class="num">{{amount .Value}}</td></tr>
+{{end}}
+<tr><th colspan="7" class="num">Total</th><th class="num">{{amount .Total}}</th></tr>
+</table>
+{{end}}
+<h3>Grand total ({{.TotalItems}} items): {{amount .GrandTotal}}</h3>
+</body>
+</html>
+`))
@@ -27,16 +27,68 @@ func InitDB() (*gorm.DB, error) {
 
 	// Auto migrate models
 	err = db.AutoMigrate(
+		&models.Location{},
+		&models.Supplier{},
 		&models.Medicine{},
+		&models.MedicineUnit{},
 		&models.MedType{},
+		&models.MedicinePrice{},
 		&models.StockUpdation{},
 		&models.StockUpdationParticulars{},
+		&models.StockLot{},
+		&models.StockUpdationLot{},
+		&models.PurchaseOrder{},
+		&models.PurchaseOrderLine{},
+		&models.StockAudit{},
+		&models.StockTake{},
+		&models.StockTakeCount{},
+		&models.StockTransfer{},
+		&models.Alert{},
+		&models.AlertDelivery{},
 		&models.Patient{},
 		&models.Visit{},
+		&models.Prescription{},
+		&models.ICD10Code{},
+		&models.VisitDiagnosis{},
+		&models.Invoice{},
+		&models.InvoiceLine{},
+		&models.InvoiceSequence{},
+		&models.PurchaseTaxLine{},
+		&models.Payment{},
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	err = models.BackfillMovementKinds(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.BackfillLocations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.CreateAlertIndexes(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.BackfillPrices(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.BackfillOpeningLots(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.CreatePatientSearchIndexes(db)
+	if err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
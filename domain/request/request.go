@@ -1,19 +1,37 @@
 package request
 
 import (
+	"fmt"
 	"med-manager/models"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type MedicineRequest struct {
-	Name         string  `json:"name" validate:"required"`
-	Description  string  `json:"description"`
-	TypeID       int     `json:"typeId" validate:"gte=1"`
-	Price        float64 `json:"price" validate:"gte=0"`
-	MinStock     int     `json:"min_stock" validate:"gte=0"`
-	OptimalStock int     `json:"optimal_stock" validate:"gte=0"`
+	Name         string   `json:"name" validate:"required"`
+	Description  string   `json:"description"`
+	TypeID       int      `json:"typeId" validate:"gte=1"`
+	Price        float64  `json:"price" validate:"gte=0"` // selling price
+	CostPrice    float64  `json:"cost_price" validate:"gte=0"`
+	MRP          float64  `json:"mrp" validate:"gte=0"`
+	HSNCode      string   `json:"hsn_code"`
+	TaxRate      *float64 `json:"tax_rate" validate:"omitempty,gte=0"` // GST rate in percent, the type's when not given
+	MinStock     int      `json:"min_stock" validate:"gte=0"`
+	OptimalStock int      `json:"optimal_stock" validate:"gte=0"`
+
+	PreferredSupplierID *int `json:"preferred_supplier_id" validate:"omitempty,gte=1"`
+
+	BaseUnit string                `json:"base_unit"`
+	Units    []MedicineUnitRequest `json:"units" validate:"omitempty,dive"`
+}
+
+// MedicineUnitRequest is a pack of the medicine, Factor is the number of base units in it.
+type MedicineUnitRequest struct {
+	Name   string `json:"name" validate:"required"`
+	Factor int    `json:"factor" validate:"required,gte=2"`
 }
 
 func (m *MedicineRequest) ToMedicine() *models.Medicine {
@@ -22,11 +40,74 @@ func (m *MedicineRequest) ToMedicine() *models.Medicine {
 		Description:  m.Description,
 		TypeID:       m.TypeID,
 		Price:        m.Price,
+		CostPrice:    m.CostPrice,
+		MRP:          m.MRP,
+		HSNCode:      m.HSNCode,
+		TaxRate:      m.TaxRate,
 		MinStock:     m.MinStock,
 		OptimalStock: m.OptimalStock,
+
+		PreferredSupplierID: m.PreferredSupplierID,
+
+		BaseUnit: m.BaseUnit,
+		Units:    m.toMedicineUnits(),
+	}
+}
+
+// MedicinePriceRequest is a price change of a medicine, effective now unless EffectiveFrom backdates it.
+type MedicinePriceRequest struct {
+	CostPrice     float64   `json:"cost_price" validate:"gte=0"`
+	MRP           float64   `json:"mrp" validate:"gte=0"`
+	SellingPrice  float64   `json:"selling_price" validate:"gte=0"`
+	EffectiveFrom time.Time `json:"effective_from"`
+}
+
+func (p *MedicinePriceRequest) ToMedicinePrice(medicineID int) *models.MedicinePrice {
+	return &models.MedicinePrice{
+		MedicineID:    medicineID,
+		CostPrice:     p.CostPrice,
+		MRP:           p.MRP,
+		SellingPrice:  p.SellingPrice,
+		EffectiveFrom: p.EffectiveFrom,
+	}
+}
+
+func (m *MedicineRequest) toMedicineUnits() []models.MedicineUnit {
+	if m.Units == nil {
+		return nil
+	}
+	units := make([]models.MedicineUnit, len(m.Units))
+	for i, unit := range m.Units {
+		units[i] = models.MedicineUnit{Name: unit.Name, Factor: unit.Factor}
+	}
+	return units
+}
+
+// PatientListRequest searches patients by name or contact with q, and filters them by age and gender.
+type PatientListRequest struct {
+	Q      string `query:"q"`
+	MinAge *int   `query:"min_age" validate:"omitempty,gte=0"`
+	MaxAge *int   `query:"max_age" validate:"omitempty,gte=0"`
+	Gender string `query:"gender"`
+	Page   int    `query:"page" validate:"gte=0"`
+	Limit  int    `query:"limit" validate:"gte=0"`
+}
+
+func (p *PatientListRequest) ToPatientSearch() *models.PatientSearch {
+	return &models.PatientSearch{
+		Query:  p.Q,
+		MinAge: p.MinAge,
+		MaxAge: p.MaxAge,
+		Gender: p.Gender,
 	}
 }
 
+// PatientMergeRequest merges the patient in the URL into another, the one kept.
+type PatientMergeRequest struct {
+	IntoPatientID int    `json:"into_patient_id" validate:"required,gte=1"`
+	MergedBy      string `json:"merged_by"`
+}
+
 type PatientReq struct {
 	Name        string         `json:"name" gorm:"column:name" validate:"required"`
 	Age         int            `json:"age" gorm:"column:age"`
@@ -51,12 +132,375 @@ type VisitReq struct {
 	PatientID int       `json:"patient_id" gorm:"column:patient_id" validate:"required,gte=1"`
 	Date      time.Time `json:"date" gorm:"column:date"`
 	Notes     string    `json:"notes" gorm:"column:notes"`
+
+	ChiefComplaint string `json:"chief_complaint"`
+	Examination    string `json:"examination"`
+
+	BPSystolic  *int     `json:"bp_systolic" validate:"required_with=BPDiastolic,omitempty,gte=50,lte=300"`
+	BPDiastolic *int     `json:"bp_diastolic" validate:"required_with=BPSystolic,omitempty,gte=20,lte=200,ltfield=BPSystolic"`
+	Pulse       *int     `json:"pulse" validate:"omitempty,gte=20,lte=250"`
+	Temperature *float64 `json:"temperature" validate:"omitempty,gte=30,lte=45"`
+	Weight      *float64 `json:"weight" validate:"omitempty,gt=0,lte=500"`
+	SpO2        *int     `json:"spo2" validate:"omitempty,gte=50,lte=100"`
+
+	Diagnoses []DiagnosisReq `json:"diagnoses" validate:"dive"`
+}
+
+// DiagnosisReq is a diagnosis with a description, an ICD-10 code from the code table or both.
+type DiagnosisReq struct {
+	ICD10Code   string `json:"icd10_code" validate:"required_without=Description,omitempty,max=10"`
+	Description string `json:"description" validate:"required_without=ICD10Code"`
 }
 
 func (v *VisitReq) ToVisit() *models.Visit {
+	diagnoses := make([]models.VisitDiagnosis, len(v.Diagnoses))
+	for i, diagnosis := range v.Diagnoses {
+		diagnoses[i].Description = diagnosis.Description
+		if diagnosis.ICD10Code != "" {
+			code := diagnosis.ICD10Code
+			diagnoses[i].ICD10Code = &code
+		}
+	}
 	return &models.Visit{
-		PatientID: v.PatientID,
-		Date:      v.Date,
-		Notes:     v.Notes,
+		PatientID:      v.PatientID,
+		Date:           v.Date,
+		Notes:          v.Notes,
+		ChiefComplaint: v.ChiefComplaint,
+		Examination:    v.Examination,
+		BPSystolic:     v.BPSystolic,
+		BPDiastolic:    v.BPDiastolic,
+		Pulse:          v.Pulse,
+		Temperature:    v.Temperature,
+		Weight:         v.Weight,
+		SpO2:           v.SpO2,
+		Diagnoses:      diagnoses,
+	}
+}
+
+// DiagnosisSearchRequest finds the visits with a diagnosis matching the ICD-10 code or the text q,
+// like q=hypertension or code=I10, optionally in a date range.
+type DiagnosisSearchRequest struct {
+	DateRange
+	Q     string `query:"q" validate:"required_without=Code"`
+	Code  string `query:"code" validate:"required_without=Q"`
+	Page  int    `query:"page" validate:"gte=0"`
+	Limit int    `query:"limit" validate:"gte=0"`
+}
+
+type ICD10CodeSearchRequest struct {
+	Q     string `query:"q"`
+	Page  int    `query:"page" validate:"gte=0"`
+	Limit int    `query:"limit" validate:"gte=0"`
+}
+
+type ReorderBillRequest struct {
+	Level  string `query:"level" validate:"omitempty,oneof=min optimal"`
+	Format string `query:"format" validate:"omitempty,oneof=json csv html"`
+}
+
+type ReorderLevelSuggestionRequest struct {
+	Days         int `query:"days" validate:"gte=0"`       // consumption history to look at, 90 when not given
+	CoverDays    int `query:"cover_days" validate:"gte=0"` // days of use optimal stock covers above min stock, 30 when not given
+	ServiceLevel int `query:"service_level" validate:"omitempty,oneof=90 95 98 99"`
+}
+
+// Defaults fills in the defaults of the parameters not given.
+func (r *ReorderLevelSuggestionRequest) Defaults() {
+	if r.Days == 0 {
+		r.Days = models.DefaultConsumptionDays
+	}
+	if r.CoverDays == 0 {
+		r.CoverDays = models.DefaultCoverDays
+	}
+	if r.ServiceLevel == 0 {
+		r.ServiceLevel = models.DefaultServiceLevel
+	}
+}
+
+type ApplyReorderLevelsRequest struct {
+	Levels []ReorderLevelRequest `json:"levels" validate:"required,min=1,dive"`
+}
+
+type ReorderLevelRequest struct {
+	MedicineID   int `json:"medicine_id" validate:"required,gte=1"`
+	MinStock     int `json:"min_stock" validate:"gte=0"`
+	OptimalStock int `json:"optimal_stock" validate:"gtefield=MinStock"`
+}
+
+func (r *ApplyReorderLevelsRequest) ToReorderLevels() []models.ReorderLevel {
+	levels := make([]models.ReorderLevel, len(r.Levels))
+	for i, level := range r.Levels {
+		levels[i] = models.ReorderLevel{
+			MedicineID:   level.MedicineID,
+			MinStock:     level.MinStock,
+			OptimalStock: level.OptimalStock,
+		}
+	}
+	return levels
+}
+
+type SupplierRequest struct {
+	Name          string `json:"name" validate:"required"`
+	ContactPerson string `json:"contact_person"`
+	Phone         string `json:"phone"`
+	Email         string `json:"email" validate:"omitempty,email"`
+	Address       string `json:"address"`
+	GSTIN         string `json:"gstin" validate:"omitempty,len=15,alphanum"`
+	LeadTimeDays  int    `json:"lead_time_days" validate:"gte=0"`
+}
+
+func (s *SupplierRequest) ToSupplier() *models.Supplier {
+	return &models.Supplier{
+		Name:          s.Name,
+		ContactPerson: s.ContactPerson,
+		Phone:         s.Phone,
+		Email:         s.Email,
+		Address:       s.Address,
+		GSTIN:         s.GSTIN,
+		LeadTimeDays:  s.LeadTimeDays,
+	}
+}
+
+type PurchaseOrderRequest struct {
+	SupplierID int                        `json:"supplier_id" validate:"required,gte=1"`
+	Notes      string                     `json:"notes"`
+	Lines      []PurchaseOrderLineRequest `json:"lines" validate:"required,min=1,dive"`
+}
+
+type PurchaseOrderLineRequest struct {
+	MedicineID int     `json:"medicine_id" validate:"required,gte=1"`
+	Quantity   int     `json:"quantity" validate:"required,gte=1"`
+	UnitPrice  float64 `json:"unit_price" validate:"gte=0"`
+}
+
+func (p *PurchaseOrderRequest) ToPurchaseOrder() *models.PurchaseOrder {
+	purchaseOrder := &models.PurchaseOrder{
+		SupplierID: p.SupplierID,
+		Notes:      p.Notes,
+	}
+	for _, line := range p.Lines {
+		purchaseOrder.Lines = append(purchaseOrder.Lines, models.PurchaseOrderLine{
+			MedicineID: line.MedicineID,
+			Quantity:   line.Quantity,
+			UnitPrice:  line.UnitPrice,
+		})
+	}
+	return purchaseOrder
+}
+
+type LocationRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+}
+
+func (l *LocationRequest) ToLocation() *models.Location {
+	return &models.Location{
+		Name:        l.Name,
+		Description: l.Description,
+	}
+}
+
+type StockTransferListRequest struct {
+	LocationID int `query:"location_id" validate:"gte=0"`
+	Page       int `query:"page" validate:"gte=0"`
+	Limit      int `query:"limit" validate:"gte=0"`
+}
+
+type PurchaseOrderListRequest struct {
+	Status     string `query:"status" validate:"omitempty,oneof=draft ordered partially_received received cancelled"`
+	SupplierID int    `query:"supplier_id" validate:"gte=0"`
+	Page       int    `query:"page" validate:"gte=0"`
+	Limit      int    `query:"limit" validate:"gte=0"`
+}
+
+type PrescriptionRequest struct {
+	Lines        []PrescriptionLineRequest `json:"lines" validate:"dive"`
+	AllowExpired bool                      `json:"allow_expired"`
+}
+
+type PrescriptionLineRequest struct {
+	MedicineID   int    `json:"medicine_id" validate:"required,gte=1"`
+	Dose         string `json:"dose" validate:"required"`
+	Frequency    string `json:"frequency" validate:"required"`
+	DurationDays int    `json:"duration_days" validate:"gte=0"`
+	Quantity     int    `json:"quantity" validate:"gte=0"`
+	Instructions string `json:"instructions"`
+}
+
+func (p *PrescriptionRequest) ToPrescriptions() []models.Prescription {
+	prescriptions := []models.Prescription{}
+	for _, line := range p.Lines {
+		prescriptions = append(prescriptions, models.Prescription{
+			MedicineID:   line.MedicineID,
+			Dose:         line.Dose,
+			Frequency:    line.Frequency,
+			DurationDays: line.DurationDays,
+			Quantity:     line.Quantity,
+			Instructions: line.Instructions,
+		})
+	}
+	return prescriptions
+}
+
+type DispenseRequest struct {
+	AllowExpired bool `json:"allow_expired"`
+	LocationID   int  `json:"location_id" validate:"omitempty,gte=1"` // the default location when not given
+}
+
+// DateRange is a date filter taken from the url query, with dates as YYYY-MM-DD and both ends inclusive.
+type DateRange struct {
+	From string `query:"from" validate:"omitempty,datetime=2006-01-02"`
+	To   string `query:"to" validate:"omitempty,datetime=2006-01-02"`
+}
+
+// Bounds returns the parsed dates, nil when not given. Call only after validation.
+func (d *DateRange) Bounds() (from, to *time.Time) {
+	return parseDate(d.From), parseDate(d.To)
+}
+
+func parseDate(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil
+	}
+	return &date
+}
+
+type StockCardRequest struct {
+	DateRange
+	LocationID int    `query:"location_id" validate:"gte=0"`
+	Format     string `query:"format" validate:"omitempty,oneof=json csv"`
+}
+
+type StockValuationRequest struct {
+	AsOf string `query:"as_of" validate:"omitempty,datetime=2006-01-02"`
+}
+
+// Date returns the day to value the stock at, today when not given. Call only after validation.
+func (r *StockValuationRequest) Date() time.Time {
+	if date := parseDate(r.AsOf); date != nil {
+		return *date
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+}
+
+type ExpiringStockRequest struct {
+	Within     string `query:"within" validate:"omitempty,endswith=d"` // days ahead, like 90d
+	LocationID int    `query:"location_id" validate:"gte=0"`
+}
+
+// WithinDays returns the window in days, the default window when not given.
+func (e *ExpiringStockRequest) WithinDays() (int, error) {
+	if e.Within == "" {
+		return models.DefaultExpiryWindowDays, nil
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(e.Within, "d"))
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("within must be a number of days like 90d")
+	}
+	return days, nil
+}
+
+type AlertListRequest struct {
+	Type   string `query:"type" validate:"omitempty,oneof=near_expiry low_stock"`
+	Status string `query:"status" validate:"omitempty,oneof=active acknowledged resolved"`
+	Page   int    `query:"page" validate:"gte=0"`
+	Limit  int    `query:"limit" validate:"gte=0"`
+}
+
+type InvoiceListRequest struct {
+	Status    string `query:"status" validate:"omitempty,oneof=draft issued cancelled"`
+	PatientID int    `query:"patient_id" validate:"gte=0"`
+	Page      int    `query:"page" validate:"gte=0"`
+	Limit     int    `query:"limit" validate:"gte=0"`
+}
+
+type PaymentRequest struct {
+	Amount     float64 `json:"amount" validate:"required,gt=0"`
+	Method     string  `json:"method" validate:"required,oneof=cash card upi"`
+	Reference  string  `json:"reference"`
+	ReceivedBy string  `json:"received_by"`
+	Notes      string  `json:"notes"`
+}
+
+func (p *PaymentRequest) ToPayment() *models.Payment {
+	return &models.Payment{
+		Amount:     p.Amount,
+		Method:     p.Method,
+		Reference:  p.Reference,
+		ReceivedBy: p.ReceivedBy,
+		Notes:      p.Notes,
+	}
+}
+
+type VoidPaymentRequest struct {
+	Reason   string `json:"reason" validate:"required"`
+	VoidedBy string `json:"voided_by"`
+}
+
+type TaxSummaryRequest struct {
+	Month string `query:"month" validate:"omitempty,datetime=2006-01"`
+}
+
+// MonthStart returns the first day of the month asked for, the current month when not given.
+// Call only after validation.
+func (r *TaxSummaryRequest) MonthStart() time.Time {
+	if month, err := time.ParseInLocation("2006-01", r.Month, time.Local); err == nil {
+		return month
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+}
+
+type CancelInvoiceRequest struct {
+	Reason      string `json:"reason" validate:"required"`
+	CancelledBy string `json:"cancelled_by"`
+}
+
+type AcknowledgeAlertRequest struct {
+	AcknowledgedBy string `json:"acknowledged_by" validate:"required"`
+}
+
+type StockRepairRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+type StockTakeRequest struct {
+	LocationID int    `json:"location_id" validate:"omitempty,gte=1"`
+	Notes      string `json:"notes"`
+	StartedBy  string `json:"started_by" validate:"required"`
+}
+
+func (s *StockTakeRequest) ToStockTake() *models.StockTake {
+	return &models.StockTake{
+		LocationID: s.LocationID,
+		Notes:      s.Notes,
+		StartedBy:  s.StartedBy,
+	}
+}
+
+type StockTakeCountRequest struct {
+	CountedBy string                      `json:"counted_by" validate:"required"`
+	Counts    []StockTakeCountLineRequest `json:"counts" validate:"required,min=1,dive"`
+}
+
+type StockTakeCountLineRequest struct {
+	MedicineID      int `json:"medicine_id" validate:"required,gte=1"`
+	CountedQuantity int `json:"counted_quantity" validate:"gte=0"`
+}
+
+func (s *StockTakeCountRequest) ToStockTakeCounts() []models.StockTakeCount {
+	counts := []models.StockTakeCount{}
+	for _, line := range s.Counts {
+		counts = append(counts, models.StockTakeCount{
+			MedicineID:      line.MedicineID,
+			CountedQuantity: line.CountedQuantity,
+			CountedBy:       s.CountedBy,
+		})
 	}
+	return counts
 }
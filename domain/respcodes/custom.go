@@ -3,4 +3,32 @@ package respcode
 const (
 	INSUFFICIENT_STOCK = "INSUFFICIENT_STOCK"
 	DUPLICATE_NAME     = "DUPLICATE_NAME"
+	INVALID_BATCH      = "INVALID_BATCH"
+	EXPIRED_STOCK      = "EXPIRED_STOCK"
+	ENTRY_NOT_VOIDABLE = "ENTRY_NOT_VOIDABLE"
+	STOCK_TAKE_CLOSED  = "STOCK_TAKE_CLOSED"
+	NO_LOT_FOR_SURPLUS = "NO_LOT_FOR_SURPLUS"
+
+	INVALID_MOVEMENT_KIND = "INVALID_MOVEMENT_KIND"
+	REASON_REQUIRED       = "REASON_REQUIRED"
+
+	INVALID_UNIT = "INVALID_UNIT"
+
+	INVALID_PRICE    = "INVALID_PRICE"
+	INVALID_TAX_RATE = "INVALID_TAX_RATE"
+
+	INVALID_INVOICE = "INVALID_INVOICE"
+	INVALID_PAYMENT = "INVALID_PAYMENT"
+
+	INVALID_LOCATION = "INVALID_LOCATION"
+
+	PATIENT_MERGED    = "PATIENT_MERGED"
+	INVALID_DIAGNOSIS = "INVALID_DIAGNOSIS"
+
+	ALREADY_ACKNOWLEDGED = "ALREADY_ACKNOWLEDGED"
+
+	INVALID_PURCHASE_ORDER = "INVALID_PURCHASE_ORDER"
+
+	ALREADY_DISPENSED   = "ALREADY_DISPENSED"
+	NOTHING_TO_DISPENSE = "NOTHING_TO_DISPENSE"
 )
@@ -3,19 +3,236 @@ package response
 import "time"
 
 type GetStockUpdationResponse struct {
-	ID          int                        `json:"id" gorm:"column:id"`
-	IsAddtion   bool                       `json:"is_addition" gorm:"column:is_addition"`
-	BroughtAt   string                     `json:"brought_at" gorm:"column:brought_at"`
-	Particulars []StockUpdationParticulars `json:"particulars" gorm:"-"`
+	ID              int                        `json:"id" gorm:"column:id"`
+	IsAddtion       bool                       `json:"is_addition" gorm:"column:is_addition"`
+	BroughtAt       string                     `json:"brought_at" gorm:"column:brought_at"`
+	Kind            string                     `json:"kind" gorm:"column:kind"`
+	LocationID      int                        `json:"location_id" gorm:"column:location_id"`
+	TransferID      *int                       `json:"transfer_id" gorm:"column:transfer_id"`
+	SupplierID      *int                       `json:"supplier_id" gorm:"column:supplier_id"`
+	PurchaseOrderID *int                       `json:"purchase_order_id" gorm:"column:purchase_order_id"`
+	VisitID         *int                       `json:"visit_id" gorm:"column:visit_id"`
+	EntryType       string                     `json:"entry_type" gorm:"column:entry_type"`
+	ReferenceID     *int                       `json:"reference_id" gorm:"column:reference_id"`
+	VoidedAt        *time.Time                 `json:"voided_at" gorm:"column:voided_at"`
+	VoidedBy        string                     `json:"voided_by" gorm:"column:voided_by"`
+	VoidReason      string                     `json:"void_reason" gorm:"column:void_reason"`
+	Reason          string                     `json:"reason" gorm:"column:reason"`
+	Particulars     []StockUpdationParticulars `json:"particulars" gorm:"-"`
+	Lots            []StockUpdationLotDetails  `json:"lots" gorm:"-"`
 }
 
 type MedicineWiseStockUpdationDetails struct {
-	StockUpdationID int       `json:"stock_updation_id" gorm:"column:stock_updation_id"`
-	BroughtAt       time.Time `json:"brought_at" gorm:"column:brought_at"`
-	Quantity        int       `json:"quantity" gorm:"column:quantity"`
+	StockUpdationID int        `json:"stock_updation_id" gorm:"column:stock_updation_id"`
+	BroughtAt       time.Time  `json:"brought_at" gorm:"column:brought_at"`
+	Quantity        int        `json:"quantity" gorm:"column:quantity"`
+	Kind            string     `json:"kind" gorm:"column:kind"`
+	EntryType       string     `json:"entry_type" gorm:"column:entry_type"`
+	VoidedAt        *time.Time `json:"voided_at" gorm:"column:voided_at"`
 }
 
 type StockUpdationParticulars struct {
 	MedicineID int `json:"medicine_id" gorm:"column:medicine_id"`
 	Quantity   int `json:"quantity" gorm:"column:quantity"`
 }
+
+type StockUpdationLotDetails struct {
+	StockLotID int       `json:"stock_lot_id" gorm:"column:stock_lot_id"`
+	MedicineID int       `json:"medicine_id" gorm:"column:medicine_id"`
+	BatchNo    string    `json:"batch_no" gorm:"column:batch_no"`
+	ExpiresAt  time.Time `json:"expires_at" gorm:"column:expires_at"`
+	Quantity   int       `json:"quantity" gorm:"column:quantity"`
+	UnitCost   float64   `json:"unit_cost" gorm:"column:unit_cost"`
+}
+
+type StockDeductionResponse struct {
+	StockUpdationID int                       `json:"stock_updation_id"`
+	Allocations     []StockUpdationLotDetails `json:"allocations"`
+}
+
+// StockCard is the chronological movement history of a medicine with running balances,
+// at one location or, when LocationID is 0, across all of them.
+type StockCard struct {
+	MedicineID     int              `json:"medicine_id"`
+	Medicine       string           `json:"medicine"`
+	LocationID     int              `json:"location_id"`
+	From           *time.Time       `json:"from"`
+	To             *time.Time       `json:"to"`
+	OpeningBalance int              `json:"opening_balance"`
+	Movements      []StockCardEntry `json:"movements"`
+	ClosingBalance int              `json:"closing_balance"`
+}
+
+type StockCardEntry struct {
+	StockUpdationID int        `json:"stock_updation_id" gorm:"column:stock_updation_id"`
+	BroughtAt       time.Time  `json:"brought_at" gorm:"column:brought_at"`
+	IsAddtion       bool       `json:"is_addition" gorm:"column:is_addition"`
+	Kind            string     `json:"kind" gorm:"column:kind"`
+	EntryType       string     `json:"entry_type" gorm:"column:entry_type"`
+	ReferenceID     *int       `json:"reference_id" gorm:"column:reference_id"`
+	LocationID      int        `json:"location_id" gorm:"column:location_id"`
+	TransferID      *int       `json:"transfer_id" gorm:"column:transfer_id"`
+	SupplierID      *int       `json:"supplier_id" gorm:"column:supplier_id"`
+	PurchaseOrderID *int       `json:"purchase_order_id" gorm:"column:purchase_order_id"`
+	VisitID         *int       `json:"visit_id" gorm:"column:visit_id"`
+	VoidedAt        *time.Time `json:"voided_at" gorm:"column:voided_at"`
+	Reason          string     `json:"reason" gorm:"column:reason"`
+	Quantity        int        `json:"-" gorm:"column:quantity"` // signed effect on stock
+	In              int        `json:"in" gorm:"-"`
+	Out             int        `json:"out" gorm:"-"`
+	Balance         int        `json:"balance" gorm:"-"`
+}
+
+// MovementSummary reports stock movements per kind, keeping losses apart from sales.
+type MovementSummary struct {
+	From       *time.Time            `json:"from"`
+	To         *time.Time            `json:"to"`
+	Kinds      []MovementKindSummary `json:"kinds"`
+	SalesValue float64               `json:"sales_value"`
+	LossValue  float64               `json:"loss_value"`
+}
+
+type MovementKindSummary struct {
+	Kind      string                `json:"kind"`
+	IsAddtion bool                  `json:"is_addition"`
+	IsLoss    bool                  `json:"is_loss"`
+	Quantity  int                   `json:"quantity"`
+	Value     float64               `json:"value"`
+	Medicines []MovementSummaryLine `json:"medicines"`
+}
+
+type MovementSummaryLine struct {
+	Kind       string  `json:"-" gorm:"column:kind"`
+	IsAddtion  bool    `json:"-" gorm:"column:is_addition"`
+	MedicineID int     `json:"medicine_id" gorm:"column:medicine_id"`
+	Medicine   string  `json:"medicine" gorm:"column:medicine"`
+	Quantity   int     `json:"quantity" gorm:"column:quantity"`
+	Value      float64 `json:"value" gorm:"column:value"`
+}
+
+// LocationStock is the balance of a medicine held at a location.
+type LocationStock struct {
+	MedicineID      int    `json:"medicine_id" gorm:"column:medicine_id"`
+	Medicine        string `json:"medicine" gorm:"column:medicine"`
+	BaseUnit        string `json:"base_unit" gorm:"column:base_unit"`
+	Quantity        int    `json:"quantity" gorm:"column:quantity"`
+	ExpiredQuantity int    `json:"expired_quantity" gorm:"column:expired_quantity"`
+	QuantityInPacks string `json:"quantity_in_packs" gorm:"-"`
+}
+
+// StockValuation is the closing value of the stock on hand at the end of a day, by the
+// first-in-first-out and the weighted average cost methods.
+type StockValuation struct {
+	AsOf                 time.Time            `json:"as_of"`
+	Medicines            []StockValuationLine `json:"medicines"`
+	FIFOValue            float64              `json:"fifo_value"`
+	WeightedAverageValue float64              `json:"weighted_average_value"`
+	UncostedQuantity     int                  `json:"uncosted_quantity"`
+}
+
+type StockValuationLine struct {
+	MedicineID           int     `json:"medicine_id" gorm:"column:medicine_id"`
+	Medicine             string  `json:"medicine" gorm:"column:medicine"`
+	BaseUnit             string  `json:"base_unit" gorm:"column:base_unit"`
+	Quantity             int     `json:"quantity" gorm:"column:quantity"`
+	FIFOValue            float64 `json:"fifo_value" gorm:"-"`
+	WeightedAverageCost  float64 `json:"weighted_average_cost" gorm:"-"`
+	WeightedAverageValue float64 `json:"weighted_average_value" gorm:"-"`
+	UncostedQuantity     int     `json:"uncosted_quantity" gorm:"-"` // on hand but bought without a recorded cost
+}
+
+// CostOfGoodsSold is the purchase cost of the stock sold or dispensed in a period, net of reversals.
+type CostOfGoodsSold struct {
+	From      *time.Time            `json:"from"`
+	To        *time.Time            `json:"to"`
+	Medicines []CostOfGoodsSoldLine `json:"medicines"`
+	TotalCost float64               `json:"total_cost"`
+}
+
+type CostOfGoodsSoldLine struct {
+	MedicineID int     `json:"medicine_id" gorm:"column:medicine_id"`
+	Medicine   string  `json:"medicine" gorm:"column:medicine"`
+	Quantity   int     `json:"quantity" gorm:"column:quantity"`
+	Cost       float64 `json:"cost" gorm:"column:cost"`
+}
+
+// TaxSummary is the GST collected on sales (output) and paid on purchases (input) in a month, by rate.
+// NetTax is what is payable, negative when the input tax is more.
+type TaxSummary struct {
+	Month     string           `json:"month"`
+	Rates     []TaxSlabSummary `json:"rates"`
+	OutputTax float64          `json:"output_tax"`
+	InputTax  float64          `json:"input_tax"`
+	NetTax    float64          `json:"net_tax"`
+}
+
+type TaxSlabSummary struct {
+	TaxRate float64        `json:"tax_rate"`
+	Output  TaxRateSummary `json:"output"`
+	Input   TaxRateSummary `json:"input"`
+	NetTax  float64        `json:"net_tax"`
+}
+
+type TaxRateSummary struct {
+	TaxRate       float64 `json:"-" gorm:"column:tax_rate"`
+	TaxableAmount float64 `json:"taxable_amount" gorm:"column:taxable_amount"`
+	CGSTAmount    float64 `json:"cgst_amount" gorm:"column:cgst_amount"`
+	SGSTAmount    float64 `json:"sgst_amount" gorm:"column:sgst_amount"`
+	IGSTAmount    float64 `json:"igst_amount" gorm:"column:igst_amount"`
+	TotalTax      float64 `json:"total_tax" gorm:"-"`
+}
+
+// PatientLedger is the running account of what a patient was billed and paid.
+type PatientLedger struct {
+	PatientID int                  `json:"patient_id"`
+	Entries   []PatientLedgerEntry `json:"entries"`
+	Balance   float64              `json:"balance"`
+}
+
+type PatientLedgerEntry struct {
+	Date      time.Time `json:"date" gorm:"column:date"`
+	Type      string    `json:"type" gorm:"column:type"` // invoice, invoice_cancelled, payment or payment_voided
+	InvoiceID int       `json:"invoice_id" gorm:"column:invoice_id"`
+	InvoiceNo *string   `json:"invoice_no" gorm:"column:invoice_no"`
+	PaymentID *int      `json:"payment_id" gorm:"column:payment_id"`
+	Method    string    `json:"method" gorm:"column:method"`
+	Debit     float64   `json:"debit" gorm:"column:debit"`
+	Credit    float64   `json:"credit" gorm:"column:credit"`
+	Balance   float64   `json:"balance" gorm:"-"`
+}
+
+// DuesAgeing is what patients owe, bucketed by the days since the invoices were issued.
+type DuesAgeing struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	Patients    []PatientDues `json:"patients"`
+	Current     float64       `json:"current"`
+	Days31To60  float64       `json:"days_31_to_60"`
+	Days61To90  float64       `json:"days_61_to_90"`
+	Over90      float64       `json:"over_90"`
+	Total       float64       `json:"total"`
+}
+
+type PatientDues struct {
+	PatientID   int       `json:"patient_id" gorm:"column:patient_id"`
+	Patient     string    `json:"patient" gorm:"column:patient"`
+	Contact     string    `json:"contact" gorm:"column:contact"`
+	Current     float64   `json:"current" gorm:"column:current"` // up to 30 days
+	Days31To60  float64   `json:"days_31_to_60" gorm:"column:days31_to60"`
+	Days61To90  float64   `json:"days_61_to_90" gorm:"column:days61_to90"`
+	Over90      float64   `json:"over_90" gorm:"column:over90"`
+	Total       float64   `json:"total" gorm:"column:total"`
+	OldestDueAt time.Time `json:"oldest_due_at" gorm:"column:oldest_due_at"`
+}
+
+// DiagnosedPatient is a visit in which a patient was given a diagnosis.
+type DiagnosedPatient struct {
+	PatientID int       `json:"patient_id" gorm:"column:patient_id"`
+	Patient   string    `json:"patient" gorm:"column:patient"`
+	Age       int       `json:"age" gorm:"column:age"`
+	Gender    string    `json:"gender" gorm:"column:gender"`
+	Contact   string    `json:"contact" gorm:"column:contact"`
+	VisitID   int       `json:"visit_id" gorm:"column:visit_id"`
+	VisitDate time.Time `json:"visit_date" gorm:"column:visit_date"`
+	ICD10Code *string   `json:"icd10_code" gorm:"column:icd10_code"`
+	Diagnosis string    `json:"diagnosis" gorm:"column:diagnosis"`
+}
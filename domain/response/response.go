@@ -1,10 +1,123 @@
 package response
 
+import "time"
+
 type StockSummary struct {
-	MedicineID           int    `json:"medicine_id"`
-	Medicine             string `json:"medicine"`
-	Quantity             int    `json:"quantity"`
-	MinStock             int    `json:"min_stock"`
-	OptimalStock         int    `json:"optimal_stock"`
-	DeficiencyToMinStock int    `json:"deficiency_to_min_stock"`
+	MedicineID               int     `json:"medicine_id"`
+	Medicine                 string  `json:"medicine"`
+	Type                     string  `json:"type"`
+	Quantity                 int     `json:"quantity"`
+	MinStock                 int     `json:"min_stock"`
+	OptimalStock             int     `json:"optimal_stock"`
+	DeficiencyToMinStock     int     `json:"deficiency_to_min_stock"`
+	DeficiencyToOptimalStock int     `json:"deficiency_to_optimal_stock"`
+	QuantityToBuy            int     `json:"quantity_to_buy"`
+	UnitPrice                float64 `json:"unit_price"`
+	Value                    float64 `json:"value"`
+	BaseUnit                 string  `json:"base_unit"`
+	QuantityInPacks          string  `json:"quantity_in_packs"`
+	QuantityToBuyInPacks     string  `json:"quantity_to_buy_in_packs"`
+}
+
+// ReorderBill is the purchase requisition of medicines below their stock levels, grouped by medicine type.
+type ReorderBill struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Level       string             `json:"level"`
+	Groups      []ReorderBillGroup `json:"groups"`
+	TotalItems  int                `json:"total_items"`
+	GrandTotal  float64            `json:"grand_total"`
+}
+
+type ReorderBillGroup struct {
+	Type  string         `json:"type"`
+	Items []StockSummary `json:"items"`
+	Total float64        `json:"total"`
+}
+
+type DraftPurchaseOrders struct {
+	PurchaseOrderIDs []int          `json:"purchase_order_ids"`
+	Skipped          []StockSummary `json:"skipped"` // medicines without a preferred supplier
+}
+
+// StockDiscrepancy is a medicine whose current stock counter disagrees with its ledger or lot balances.
+type StockDiscrepancy struct {
+	MedicineID   int    `json:"medicine_id"`
+	Medicine     string `json:"medicine"`
+	CurrentStock int    `json:"current_stock"`
+	LedgerStock  int    `json:"ledger_stock"`
+	LotStock     int    `json:"lot_stock"`
+	Repaired     bool   `json:"repaired" gorm:"-"`
+}
+
+type StockTakeReport struct {
+	ID             int                 `json:"id"`
+	LocationID     int                 `json:"location_id"`
+	Status         string              `json:"status"`
+	Notes          string              `json:"notes"`
+	StartedBy      string              `json:"started_by"`
+	StartedAt      time.Time           `json:"started_at"`
+	FinalisedAt    *time.Time          `json:"finalised_at"`
+	AdditionID     *int                `json:"addition_id"`
+	DeductionID    *int                `json:"deduction_id"`
+	Lines          []StockTakeVariance `json:"lines"`
+	SurplusValue   float64             `json:"surplus_value"`
+	ShortageValue  float64             `json:"shortage_value"`
+	NetValueImpact float64             `json:"net_value_impact"`
+}
+
+type StockTakeVariance struct {
+	MedicineID      int       `json:"medicine_id"`
+	Medicine        string    `json:"medicine"`
+	SystemQuantity  int       `json:"system_quantity"`
+	CountedQuantity int       `json:"counted_quantity"`
+	CountedBy       string    `json:"counted_by"`
+	CountedAt       time.Time `json:"counted_at"`
+	Variance        int       `json:"variance" gorm:"-"`
+	UnitPrice       float64   `json:"unit_price"`
+	ValueImpact     float64   `json:"value_impact" gorm:"-"`
+}
+
+// ExpiryReport lists lots still in stock that expire within a window, or have already expired.
+type ExpiryReport struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	WithinDays  int           `json:"within_days,omitempty"`
+	Lots        []ExpiringLot `json:"lots"`
+	TotalValue  float64       `json:"total_value"`
+	Medicines   int           `json:"medicines"`
+}
+
+type ExpiringLot struct {
+	StockLotID   int       `json:"stock_lot_id"`
+	MedicineID   int       `json:"medicine_id"`
+	Medicine     string    `json:"medicine"`
+	LocationID   int       `json:"location_id"`
+	Location     string    `json:"location"`
+	BatchNo      string    `json:"batch_no"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	DaysToExpiry int       `json:"days_to_expiry"` // negative once expired
+	Quantity     int       `json:"quantity"`
+	UnitPrice    float64   `json:"unit_price"`
+	Value        float64   `json:"value"`
+}
+
+// ReorderLevelSuggestions are min and optimal stock levels worked out from past consumption, for review.
+type ReorderLevelSuggestions struct {
+	Days         int                      `json:"days"`
+	CoverDays    int                      `json:"cover_days"`
+	ServiceLevel int                      `json:"service_level"`
+	Suggestions  []ReorderLevelSuggestion `json:"suggestions"`
+}
+
+type ReorderLevelSuggestion struct {
+	MedicineID            int     `json:"medicine_id"`
+	Medicine              string  `json:"medicine"`
+	CurrentStock          int     `json:"current_stock"`
+	MinStock              int     `json:"min_stock"`
+	OptimalStock          int     `json:"optimal_stock"`
+	LeadTimeDays          int     `json:"lead_time_days"`
+	AverageDailyUse       float64 `json:"average_daily_use" gorm:"-"`
+	DailyUseDeviation     float64 `json:"daily_use_deviation" gorm:"-"`
+	SafetyStock           int     `json:"safety_stock" gorm:"-"`
+	SuggestedMinStock     int     `json:"suggested_min_stock" gorm:"-"`
+	SuggestedOptimalStock int     `json:"suggested_optimal_stock" gorm:"-"`
 }
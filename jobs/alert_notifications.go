@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"log"
+	"med-manager/models"
+	"med-manager/utils/notify"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const notificationBatchSize = 100
+
+// StartAlertNotifications pushes newly raised alerts through the channels every interval in the background.
+// Each channel's delivery is recorded, and an alert is marked notified once every channel delivered it,
+// so a failed channel is retried on the next run without the others sending it again.
+func StartAlertNotifications(db *gorm.DB, channels []notify.Channel, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			sendAlertNotifications(db, channels)
+			<-ticker.C
+		}
+	}()
+}
+
+func sendAlertNotifications(db *gorm.DB, channels []notify.Channel) {
+	alerts, err := models.GetUnnotifiedAlerts(db, notificationBatchSize)
+	if err != nil {
+		log.Printf("Failed to load alerts to notify: %v", err)
+		return
+	}
+
+	for _, alert := range alerts {
+		// a shortage that recovered before it could be pushed, like a transfer passing through, is not news
+		if alert.ResolvedAt != nil {
+			if err := models.MarkAlertNotified(db, alert.ID); err != nil {
+				log.Printf("Failed to mark alert %d notified: %v", alert.ID, err)
+			}
+			continue
+		}
+
+		delivered, err := models.GetAlertDeliveredChannels(db, alert.ID)
+		if err != nil {
+			log.Printf("Failed to load deliveries of alert %d: %v", alert.ID, err)
+			continue
+		}
+
+		notification := notify.Notification{
+			ID:         alert.ID,
+			Type:       alert.Type,
+			MedicineID: alert.MedicineID,
+			Message:    alert.Message,
+			RaisedAt:   alert.RaisedAt,
+		}
+		allDelivered := true
+		for _, channel := range channels {
+			if delivered[channel.Name] {
+				continue
+			}
+			if err := channel.Notifier.Notify(notification); err != nil {
+				log.Printf("Failed to notify alert %d through %s: %v", alert.ID, channel.Name, err)
+				allDelivered = false
+				continue
+			}
+			if err := models.RecordAlertDelivery(db, alert.ID, channel.Name); err != nil {
+				log.Printf("Failed to record delivery of alert %d through %s: %v", alert.ID, channel.Name, err)
+				allDelivered = false
+			}
+		}
+		if !allDelivered {
+			continue
+		}
+
+		err = models.MarkAlertNotified(db, alert.ID)
+		if err != nil {
+			log.Printf("Failed to mark alert %d notified: %v", alert.ID, err)
+		}
+	}
+}
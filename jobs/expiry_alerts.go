@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"log"
+	"med-manager/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StartExpiryAlerts checks for near-expiry lots right away and then every interval in the background,
+// raising an alert for each lot that has newly come within withinDays of its expiry.
+func StartExpiryAlerts(db *gorm.DB, interval time.Duration, withinDays int) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			raiseExpiryAlerts(db, withinDays)
+			<-ticker.C
+		}
+	}()
+}
+
+func raiseExpiryAlerts(db *gorm.DB, withinDays int) {
+	alerts, err := models.RaiseNearExpiryAlerts(db, withinDays)
+	if err != nil {
+		log.Printf("Failed to raise near-expiry alerts: %v", err)
+		return
+	}
+	if len(alerts) > 0 {
+		log.Printf("Raised %d near-expiry alerts", len(alerts))
+	}
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	AlertNearExpiry = "near_expiry"
+	AlertLowStock   = "low_stock"
+)
+
+const (
+	AlertStatusActive       = "active"
+	AlertStatusAcknowledged = "acknowledged"
+	AlertStatusResolved     = "resolved"
+)
+
+var ErrAlreadyAcknowledged = fmt.Errorf("Alert is already acknowledged")
+
+// Alert is something staff should act on, like a lot nearing expiry that can still be returned to the supplier
+// or a medicine that has fallen below its minimum stock. Alerts are pushed to the notifiers once, after they commit.
+type Alert struct {
+	ID         int       `json:"id" gorm:"column:id;primaryKey"`
+	Type       string    `json:"type" gorm:"column:type;index"`
+	MedicineID int       `json:"medicine_id" gorm:"column:medicine_id;index"`
+	StockLotID *int      `json:"stock_lot_id" gorm:"column:stock_lot_id;index"`
+	LocationID *int      `json:"location_id" gorm:"column:location_id"`
+	Message    string    `json:"message" gorm:"column:message"`
+	RaisedAt   time.Time `json:"raised_at" gorm:"column:raised_at;index"`
+
+	AcknowledgedAt *time.Time `json:"acknowledged_at" gorm:"column:acknowledged_at"`
+	AcknowledgedBy string     `json:"acknowledged_by" gorm:"column:acknowledged_by"`
+	ResolvedAt     *time.Time `json:"resolved_at" gorm:"column:resolved_at"` // set when a low stock medicine recovers
+	NotifiedAt     *time.Time `json:"notified_at" gorm:"column:notified_at;index"`
+
+	Medicine Medicine  `json:"-" gorm:"foreignKey:MedicineID;references:ID"`
+	StockLot *StockLot `json:"-" gorm:"foreignKey:StockLotID;references:ID"`
+}
+
+// AlertDelivery records that an alert was delivered through a notification channel.
+type AlertDelivery struct {
+	AlertID     int       `json:"alert_id" gorm:"column:alert_id;primaryKey"`
+	Channel     string    `json:"channel" gorm:"column:channel;primaryKey"`
+	DeliveredAt time.Time `json:"delivered_at" gorm:"column:delivered_at"`
+
+	Alert Alert `json:"-" gorm:"foreignKey:AlertID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+// RaiseNearExpiryAlerts raises an alert for every lot in stock that has come within the window
+// since the last run. A lot is alerted once, so reruns only pick up lots that are newly near expiry.
+func RaiseNearExpiryAlerts(db *gorm.DB, withinDays int) ([]Alert, error) {
+	report, err := getExpiryReport(db, time.Time{}, time.Now().AddDate(0, 0, withinDays), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var alertedLotIDs []int
+	err = db.Model(&Alert{}).Where("type = ? AND stock_lot_id IS NOT NULL", AlertNearExpiry).Pluck("stock_lot_id", &alertedLotIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	alerted := make(map[int]bool, len(alertedLotIDs))
+	for _, lotID := range alertedLotIDs {
+		alerted[lotID] = true
+	}
+
+	alerts := []Alert{}
+	for _, lot := range report.Lots {
+		if alerted[lot.StockLotID] {
+			continue
+		}
+		lotID, locationID := lot.StockLotID, lot.LocationID
+		alerts = append(alerts, Alert{
+			Type:       AlertNearExpiry,
+			MedicineID: lot.MedicineID,
+			StockLotID: &lotID,
+			LocationID: &locationID,
+			Message:    nearExpiryMessage(lot.Medicine, lot.BatchNo, lot.Location, lot.ExpiresAt, lot.Quantity),
+			RaisedAt:   report.GeneratedAt,
+		})
+	}
+	if len(alerts) == 0 {
+		return alerts, nil
+	}
+
+	err = db.Create(&alerts).Error
+	if err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+func nearExpiryMessage(medicine, batchNo, location string, expiresAt time.Time, quantity int) string {
+	verb := "expires"
+	if !expiresAt.After(time.Now()) {
+		verb = "expired"
+	}
+	return fmt.Sprintf("%s batch %s at %s %s on %s with %d in stock", medicine, batchNo, location, verb, expiresAt.Format("02 Jan 2006"), quantity)
+}
+
+// CreateAlertIndexes adds the partial unique index that keeps a single unresolved low stock alert per medicine.
+func CreateAlertIndexes(db *gorm.DB) error {
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_alerts_open_low_stock ON alerts (medicine_id) WHERE type = 'low_stock' AND resolved_at IS NULL").Error
+}
+
+// refreshLowStockAlerts raises a low stock alert for each of the medicines that is below its minimum stock
+// or out of stock, unless one is already open, and resolves the open alerts of the medicines that have recovered.
+// It is run inside the transaction of every stock movement, after the current stock is updated.
+func refreshLowStockAlerts(tx *gorm.DB, medicineIDs []int) error {
+	if len(medicineIDs) == 0 {
+		return nil
+	}
+
+	err := tx.Exec(`
+		UPDATE alerts SET resolved_at = ?
+		WHERE type = ? AND resolved_at IS NULL AND medicine_id IN (
+			SELECT id FROM medicines WHERE id IN ? AND current_stock >= min_stock AND current_stock > 0
+		)`, time.Now(), AlertLowStock, medicineIDs).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Exec(`
+		INSERT INTO alerts (type, medicine_id, message, raised_at)
+		SELECT
+			?,
+			id,
+			CASE WHEN current_stock = 0
+				THEN name || ' is out of stock'
+				ELSE name || ' is below its minimum stock with ' || current_stock || ' in stock against a minimum of ' || min_stock
+			END,
+			?
+		FROM
+			medicines
+		WHERE
+			id IN ?
+			AND (current_stock < min_stock OR current_stock = 0)
+		ON CONFLICT (medicine_id) WHERE type = 'low_stock' AND resolved_at IS NULL DO NOTHING
+	`, AlertLowStock, time.Now(), medicineIDs).Error
+}
+
+// GetAlerts lists alerts newest first, of one type and status when they are given.
+func GetAlerts(db *gorm.DB, alertType, status string, offset, limit int) ([]Alert, error) {
+	var alerts []Alert
+	query := db.Order("raised_at DESC, id DESC")
+	if alertType != "" {
+		query = query.Where("type = ?", alertType)
+	}
+	switch status {
+	case AlertStatusActive:
+		query = query.Where("acknowledged_at IS NULL AND resolved_at IS NULL")
+	case AlertStatusAcknowledged:
+		query = query.Where("acknowledged_at IS NOT NULL")
+	case AlertStatusResolved:
+		query = query.Where("resolved_at IS NOT NULL")
+	}
+	err := query.Offset(offset).Limit(limit).Find(&alerts).Error
+	return alerts, err
+}
+
+func GetAlertByID(db *gorm.DB, id int) (*Alert, error) {
+	var alert Alert
+	err := db.First(&alert, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// AcknowledgeAlert records that someone has seen the alert. A low stock alert stays open until the
+// medicine recovers, so a fresh one is not raised for the same shortage.
+func AcknowledgeAlert(db *gorm.DB, id int, acknowledgedBy string) error {
+	if _, err := GetAlertByID(db, id); err != nil {
+		return err
+	}
+
+	result := db.Model(&Alert{}).Where("id = ? AND acknowledged_at IS NULL", id).Updates(map[string]interface{}{
+		"acknowledged_at": time.Now(),
+		"acknowledged_by": acknowledgedBy,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAlreadyAcknowledged
+	}
+	return nil
+}
+
+// GetUnnotifiedAlerts returns the alerts not yet pushed to the notifiers, oldest first.
+func GetUnnotifiedAlerts(db *gorm.DB, limit int) ([]Alert, error) {
+	var alerts []Alert
+	err := db.Where("notified_at IS NULL").Order("raised_at, id").Limit(limit).Find(&alerts).Error
+	return alerts, err
+}
+
+func MarkAlertNotified(db *gorm.DB, id int) error {
+	return db.Model(&Alert{}).Where("id = ?", id).Update("notified_at", time.Now()).Error
+}
+
+// GetAlertDeliveredChannels returns the channels the alert was already delivered through.
+func GetAlertDeliveredChannels(db *gorm.DB, alertID int) (map[string]bool, error) {
+	var channels []string
+	err := db.Model(&AlertDelivery{}).Where("alert_id = ?", alertID).Pluck("channel", &channels).Error
+	if err != nil {
+		return nil, err
+	}
+	delivered := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		delivered[channel] = true
+	}
+	return delivered, nil
+}
+
+func RecordAlertDelivery(db *gorm.DB, alertID int, channel string) error {
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&AlertDelivery{AlertID: alertID, Channel: channel, DeliveredAt: time.Now()}).Error
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StockAudit records a repair of a medicine's current stock counter.
+type StockAudit struct {
+	ID         int       `json:"id" gorm:"column:id;primaryKey"`
+	MedicineID int       `json:"medicine_id" gorm:"column:medicine_id;index"`
+	OldStock   int       `json:"old_stock" gorm:"column:old_stock"`
+	NewStock   int       `json:"new_stock" gorm:"column:new_stock"`
+	LotStock   int       `json:"lot_stock" gorm:"column:lot_stock"`
+	Source     string    `json:"source" gorm:"column:source"`
+	Reason     string    `json:"reason" gorm:"column:reason"`
+	CreatedAt  time.Time `json:"created_at" gorm:"column:created_at"`
+
+	Medicine Medicine `json:"-" gorm:"foreignKey:MedicineID;references:ID"`
+}
+
+const stockConsistencyQuery = `
+	SELECT
+		m.id AS medicine_id,
+		m.name AS medicine,
+		m.current_stock,
+		COALESCE(ledger.quantity, 0) AS ledger_stock,
+		COALESCE(lots.quantity, 0) AS lot_stock
+	FROM
+		medicines m
+	LEFT JOIN (
+		SELECT
+			sup.medicine_id,
+			SUM(` + signedQuantitySQL + `) AS quantity
+		FROM
+			stock_updation_particulars sup
+		JOIN
+			stock_updations su
+		ON
+			sup.stock_updation_id = su.id
+		GROUP BY
+			sup.medicine_id
+	) ledger ON ledger.medicine_id = m.id
+	LEFT JOIN (
+		SELECT
+			medicine_id,
+			SUM(quantity) AS quantity
+		FROM
+			stock_lots
+		GROUP BY
+			medicine_id
+	) lots ON lots.medicine_id = m.id
+	WHERE
+		m.current_stock <> COALESCE(ledger.quantity, 0)
+		OR m.current_stock <> COALESCE(lots.quantity, 0)
+	ORDER BY
+		m.id
+`
+
+// CheckStockConsistency recomputes every medicine's stock from the ledger and from its lots,
+// and returns the medicines whose current stock counter disagrees with either.
+func CheckStockConsistency(db *gorm.DB) ([]response.StockDiscrepancy, error) {
+	discrepancies := []response.StockDiscrepancy{}
+	err := db.Raw(stockConsistencyQuery).Scan(&discrepancies).Error
+	if err != nil {
+		return nil, err
+	}
+	return discrepancies, nil
+}
+
+// RepairStockConsistency sets the current stock of every inconsistent medicine to its ledger stock
+// and records a StockAudit for each change. Lot balances are only reported, not changed.
+func RepairStockConsistency(db *gorm.DB, source, reason string) ([]response.StockDiscrepancy, error) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	discrepancies, err := CheckStockConsistency(tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	medicineIDs := []int{}
+	for i := range discrepancies {
+		medicineIDs = append(medicineIDs, discrepancies[i].MedicineID)
+	}
+	err = lockMedicines(tx, medicineIDs)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// check again now that the rows are locked, a movement may have committed in between
+	discrepancies, err = CheckStockConsistency(tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	for i := range discrepancies {
+		if discrepancies[i].CurrentStock == discrepancies[i].LedgerStock {
+			continue
+		}
+
+		err = tx.Model(&Medicine{}).Where("id = ?", discrepancies[i].MedicineID).Update("current_stock", discrepancies[i].LedgerStock).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		err = tx.Create(&StockAudit{
+			MedicineID: discrepancies[i].MedicineID,
+			OldStock:   discrepancies[i].CurrentStock,
+			NewStock:   discrepancies[i].LedgerStock,
+			LotStock:   discrepancies[i].LotStock,
+			Source:     source,
+			Reason:     reason,
+		}).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		discrepancies[i].Repaired = true
+	}
+
+	err = refreshLowStockAlerts(tx, medicineIDs)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return discrepancies, tx.Commit().Error
+}
+
+func GetStockAudits(db *gorm.DB, offset, limit int) ([]StockAudit, error) {
+	var audits []StockAudit
+	err := db.Order("created_at DESC").Offset(offset).Limit(limit).Find(&audits).Error
+	return audits, err
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"med-manager/domain/response"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUnknownICD10Code  = fmt.Errorf("ICD-10 code is not in the code table")
+	ErrDiagnosisRequired = fmt.Errorf("Diagnosis needs a description or an ICD-10 code")
+)
+
+// ICD10Code is an entry of the ICD-10 code table, loaded from a file with the load-icd10 command.
+type ICD10Code struct {
+	Code        string `json:"code" gorm:"column:code;primaryKey"` // like I10 or E11.9
+	Description string `json:"description" gorm:"column:description"`
+}
+
+func (c *ICD10Code) TableName() string {
+	return "icd10_codes"
+}
+
+// VisitDiagnosis is a diagnosis made in a visit. The code is optional, and without a description
+// the code table's description is used.
+type VisitDiagnosis struct {
+	ID          int     `json:"id" gorm:"column:id;primaryKey"`
+	VisitID     int     `json:"visit_id" gorm:"column:visit_id;index"`
+	ICD10Code   *string `json:"icd10_code" gorm:"column:icd10_code;index"`
+	Description string  `json:"description" gorm:"column:description"`
+
+	Visit Visit      `json:"-" gorm:"foreignKey:VisitID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Code  *ICD10Code `json:"-" gorm:"foreignKey:ICD10Code;references:Code"`
+}
+
+// normalizeICD10Code upper-cases the code and drops spaces, so i10 and "E11.9 " match the table.
+func normalizeICD10Code(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(code, " ", ""))
+}
+
+// LoadICD10Codes reads code,description rows from a CSV file into the code table, updating the descriptions
+// of codes already loaded. A first row headed code is skipped. It returns the number of codes read.
+func LoadICD10Codes(db *gorm.DB, r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var codes []ICD10Code
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if len(record) < 2 {
+			return 0, fmt.Errorf("ICD-10 code row %v needs a code and a description", record)
+		}
+		code := normalizeICD10Code(record[0])
+		if code == "" || (len(codes) == 0 && code == "CODE") {
+			continue
+		}
+		codes = append(codes, ICD10Code{Code: code, Description: strings.TrimSpace(record[1])})
+	}
+	if len(codes) == 0 {
+		return 0, nil
+	}
+
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"description"}),
+	}).CreateInBatches(&codes, 1000).Error
+	if err != nil {
+		return 0, err
+	}
+	return len(codes), nil
+}
+
+// SearchICD10Codes lists the codes starting with q or with a description containing it.
+func SearchICD10Codes(db *gorm.DB, q string, offset, limit int) ([]ICD10Code, error) {
+	codes := []ICD10Code{}
+	query := db.Order("code")
+	if q = strings.TrimSpace(q); q != "" {
+		query = query.Where("code LIKE ? OR description ILIKE ?", escapeLike(normalizeICD10Code(q))+"%", "%"+escapeLike(q)+"%")
+	}
+	err := query.Offset(offset).Limit(limit).Find(&codes).Error
+	return codes, err
+}
+
+// saveVisitDiagnoses replaces the visit's diagnoses with the ones on v, checking their codes against the code table.
+func saveVisitDiagnoses(tx *gorm.DB, v *Visit) error {
+	err := tx.Where("visit_id = ?", v.ID).Delete(&VisitDiagnosis{}).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range v.Diagnoses {
+		diagnosis := &v.Diagnoses[i]
+		diagnosis.ID = 0
+		diagnosis.VisitID = v.ID
+		diagnosis.Description = strings.TrimSpace(diagnosis.Description)
+		if diagnosis.ICD10Code != nil {
+			code := normalizeICD10Code(*diagnosis.ICD10Code)
+			diagnosis.ICD10Code = &code
+			if code == "" {
+				diagnosis.ICD10Code = nil
+			}
+		}
+
+		if diagnosis.ICD10Code != nil {
+			var icd10Code ICD10Code
+			err = tx.First(&icd10Code, "code = ?", *diagnosis.ICD10Code).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUnknownICD10Code
+			}
+			if err != nil {
+				return err
+			}
+			if diagnosis.Description == "" {
+				diagnosis.Description = icd10Code.Description
+			}
+		}
+		if diagnosis.Description == "" {
+			return ErrDiagnosisRequired
+		}
+	}
+
+	if len(v.Diagnoses) == 0 {
+		return nil
+	}
+	return tx.Omit("Visit", "Code").Create(&v.Diagnoses).Error
+}
+
+// GetDiagnosedPatients lists the visits between the dates with a diagnosis whose code starts with the
+// given code, so I10 finds I10 and its subcodes, or whose description or code description contains q.
+func GetDiagnosedPatients(db *gorm.DB, q, code string, from, to *time.Time, offset, limit int) ([]response.DiagnosedPatient, error) {
+	patients := []response.DiagnosedPatient{}
+	query := db.Table("visit_diagnoses vd").
+		Select(`p.id AS patient_id,
+			p.name AS patient,
+			p.age,
+			p.gender,
+			p.contact,
+			v.id AS visit_id,
+			v.date AS visit_date,
+			vd.icd10_code,
+			vd.description AS diagnosis`).
+		Joins("JOIN visits v ON vd.visit_id = v.id").
+		Joins("JOIN patients p ON v.patient_id = p.id").
+		Joins("LEFT JOIN icd10_codes c ON vd.icd10_code = c.code").
+		Where("p.deleted_at IS NULL")
+	if code = normalizeICD10Code(code); code != "" {
+		query = query.Where("vd.icd10_code LIKE ?", escapeLike(code)+"%")
+	}
+	if q = strings.TrimSpace(q); q != "" {
+		pattern := "%" + escapeLike(q) + "%"
+		query = query.Where("vd.description ILIKE ? OR c.description ILIKE ?", pattern, pattern)
+	}
+	if from != nil {
+		query = query.Where("v.date >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("v.date < ?", to.AddDate(0, 0, 1))
+	}
+	err := query.Order("v.date DESC, vd.id").Offset(offset).Limit(limit).Scan(&patients).Error
+	return patients, err
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"math"
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultExpiryWindowDays is how far ahead a lot counts as near expiry when no window is given.
+const DefaultExpiryWindowDays = 90
+
+// GetExpiringStock lists the lots in stock expiring within the given number of days from now,
+// soonest first, valued at the medicine price. A locationID of 0 covers all locations.
+func GetExpiringStock(db *gorm.DB, withinDays, locationID int) (*response.ExpiryReport, error) {
+	now := time.Now()
+	report, err := getExpiryReport(db, now, now.AddDate(0, 0, withinDays), locationID)
+	if err != nil {
+		return nil, err
+	}
+	report.WithinDays = withinDays
+	return report, nil
+}
+
+// GetExpiredStock lists the lots that have already expired but still hold stock.
+func GetExpiredStock(db *gorm.DB, locationID int) (*response.ExpiryReport, error) {
+	return getExpiryReport(db, time.Time{}, time.Now(), locationID)
+}
+
+// getExpiryReport lists the lots in stock expiring after from and up to until.
+func getExpiryReport(db *gorm.DB, from, until time.Time, locationID int) (*response.ExpiryReport, error) {
+	lots := []response.ExpiringLot{}
+	query := db.Table("stock_lots sl").
+		Select(`sl.id AS stock_lot_id,
+			sl.medicine_id,
+			m.name AS medicine,
+			sl.location_id,
+			COALESCE(l.name, '') AS location,
+			sl.batch_no,
+			sl.expires_at,
+			sl.quantity,
+			m.price AS unit_price`).
+		Joins("JOIN medicines m ON sl.medicine_id = m.id").
+		Joins("LEFT JOIN locations l ON sl.location_id = l.id").
+		Where("sl.quantity > 0 AND sl.expires_at <= ?", until)
+	if !from.IsZero() {
+		query = query.Where("sl.expires_at > ?", from)
+	}
+	if locationID != 0 {
+		query = query.Where("sl.location_id = ?", locationID)
+	}
+	err := query.Order("sl.expires_at, m.name, sl.id").Scan(&lots).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := &response.ExpiryReport{
+		GeneratedAt: now,
+		Lots:        lots,
+	}
+	medicines := make(map[int]bool)
+	for i := range report.Lots {
+		lot := &report.Lots[i]
+		lot.DaysToExpiry = int(math.Ceil(lot.ExpiresAt.Sub(now).Hours() / 24))
+		lot.Value = float64(lot.Quantity) * lot.UnitPrice
+		report.TotalValue += lot.Value
+		medicines[lot.MedicineID] = true
+	}
+	report.Medicines = len(medicines)
+
+	return report, nil
+}
@@ -0,0 +1,496 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Invoice statuses. A draft has no number yet and its discounts and tax can still change.
+// Issuing gives it the next number of its financial year, and cancelling reverses its stock deduction.
+const (
+	InvoiceDraft     = "draft"
+	InvoiceIssued    = "issued"
+	InvoiceCancelled = "cancelled"
+)
+
+var (
+	ErrNotASale           = fmt.Errorf("Only sale deductions can be invoiced")
+	ErrAlreadyInvoiced    = fmt.Errorf("Stock deduction is already invoiced")
+	ErrInvoiceNotDraft    = fmt.Errorf("Only draft invoices can be changed or issued")
+	ErrInvoiceCancelled   = fmt.Errorf("Invoice is already cancelled")
+	ErrInvoicedEntry      = fmt.Errorf("Stock deduction is invoiced, cancel the invoice instead")
+	ErrNotInInvoice       = fmt.Errorf("Medicine is not in the invoice")
+	ErrInvoiceSourceUnset = fmt.Errorf("Either a stock deduction or a visit is required to invoice")
+)
+
+// Invoice bills a sale deduction, made at the counter or by dispensing a visit's prescription.
+// Line prices are the selling prices snapshotted on the deduction.
+type Invoice struct {
+	ID              int        `json:"id" gorm:"column:id;primaryKey"`
+	InvoiceNo       *string    `json:"invoice_no" gorm:"column:invoice_no;unique"` // set when issued, like INV/2025-26/00001
+	FinancialYear   string     `json:"financial_year" gorm:"column:financial_year"`
+	Status          string     `json:"status" gorm:"column:status;default:draft;index"`
+	PatientID       *int       `json:"patient_id" gorm:"column:patient_id;index"`
+	VisitID         *int       `json:"visit_id" gorm:"column:visit_id"`
+	StockUpdationID int        `json:"stock_updation_id" gorm:"column:stock_updation_id;uniqueIndex"`
+	InterState      bool       `json:"inter_state" gorm:"column:inter_state"` // charged IGST instead of CGST and SGST
+	SubTotal        float64    `json:"sub_total" gorm:"column:sub_total"`
+	DiscountTotal   float64    `json:"discount_total" gorm:"column:discount_total"`
+	CGSTTotal       float64    `json:"cgst_total" gorm:"column:cgst_total"`
+	SGSTTotal       float64    `json:"sgst_total" gorm:"column:sgst_total"`
+	IGSTTotal       float64    `json:"igst_total" gorm:"column:igst_total"`
+	TaxTotal        float64    `json:"tax_total" gorm:"column:tax_total"`
+	Total           float64    `json:"total" gorm:"column:total"`
+	AmountPaid      float64    `json:"amount_paid" gorm:"column:amount_paid;default:0"`
+	PaymentStatus   string     `json:"payment_status" gorm:"column:payment_status;default:unpaid"`
+	Notes           string     `json:"notes" gorm:"column:notes"`
+	CreatedAt       time.Time  `json:"created_at" gorm:"column:created_at"`
+	IssuedAt        *time.Time `json:"issued_at" gorm:"column:issued_at"`
+	CancelledAt     *time.Time `json:"cancelled_at" gorm:"column:cancelled_at"`
+	CancelledBy     string     `json:"cancelled_by" gorm:"column:cancelled_by"`
+	CancelReason    string     `json:"cancel_reason" gorm:"column:cancel_reason"`
+
+	Lines []InvoiceLine `json:"lines" gorm:"foreignKey:InvoiceID;constraint:OnDelete:CASCADE"`
+
+	Patient       *Patient       `json:"-" gorm:"foreignKey:PatientID;references:ID"`
+	Visit         *Visit         `json:"-" gorm:"foreignKey:VisitID;references:ID"`
+	StockUpdation *StockUpdation `json:"-" gorm:"foreignKey:StockUpdationID;references:ID"`
+}
+
+// InvoiceLine is a medicine billed on an invoice. The discount is taken off the gross amount, at selling
+// prices that include GST, and the GST in what is left is worked out at the medicine's rate when the invoice was made.
+type InvoiceLine struct {
+	ID              int     `json:"id" gorm:"column:id;primaryKey"`
+	InvoiceID       int     `json:"invoice_id" gorm:"column:invoice_id;index"`
+	MedicineID      int     `json:"medicine_id" gorm:"column:medicine_id"`
+	Medicine        string  `json:"medicine" gorm:"column:medicine"`
+	HSNCode         string  `json:"hsn_code" gorm:"column:hsn_code"`
+	Quantity        int     `json:"quantity" gorm:"column:quantity"`
+	UnitPrice       float64 `json:"unit_price" gorm:"column:unit_price"`
+	MRP             float64 `json:"mrp" gorm:"column:mrp"`
+	GrossAmount     float64 `json:"gross_amount" gorm:"column:gross_amount"`
+	DiscountPercent float64 `json:"discount_percent" gorm:"column:discount_percent"`
+	DiscountAmount  float64 `json:"discount_amount" gorm:"column:discount_amount"`
+	TaxableAmount   float64 `json:"taxable_amount" gorm:"column:taxable_amount"`
+	TaxRate         float64 `json:"tax_rate" gorm:"column:tax_rate"`
+	CGSTAmount      float64 `json:"cgst_amount" gorm:"column:cgst_amount"`
+	SGSTAmount      float64 `json:"sgst_amount" gorm:"column:sgst_amount"`
+	IGSTAmount      float64 `json:"igst_amount" gorm:"column:igst_amount"`
+	TaxAmount       float64 `json:"tax_amount" gorm:"column:tax_amount"`
+	Amount          float64 `json:"amount" gorm:"column:amount"`
+}
+
+// InvoiceSequence is the last invoice number used in a financial year.
+type InvoiceSequence struct {
+	FinancialYear string `gorm:"column:financial_year;primaryKey"`
+	LastNumber    int    `gorm:"column:last_number"`
+}
+
+// roundAmount rounds to the paisa, halves away from zero. The float error is rounded off first, so that
+// an amount like 1.005, held as 1.00499..., still rounds up.
+func roundAmount(amount float64) float64 {
+	return math.Round(math.Round(amount*1e6)/1e4) / 100
+}
+
+// financialYear returns the April to March financial year of the time, like 2025-26.
+func financialYear(t time.Time) string {
+	year := t.Year()
+	if t.Month() < time.April {
+		year--
+	}
+	return fmt.Sprintf("%d-%02d", year, (year+1)%100)
+}
+
+// applyCharges sets the discounts of the lines, a line's own discount taking precedence over the
+// invoice's, and works out the line amounts, their GST and the invoice totals.
+func (inv *Invoice) applyCharges(charges *InvoiceChargesRequest) error {
+	lineDiscounts := make(map[int]float64)
+	for _, line := range charges.Lines {
+		lineDiscounts[line.MedicineID] = line.DiscountPercent
+	}
+
+	inv.InterState = charges.InterState
+	inv.SubTotal, inv.DiscountTotal, inv.TaxTotal, inv.Total = 0, 0, 0, 0
+	inv.CGSTTotal, inv.SGSTTotal, inv.IGSTTotal = 0, 0, 0
+	for i := range inv.Lines {
+		line := &inv.Lines[i]
+		line.DiscountPercent = charges.DiscountPercent
+		if discount, ok := lineDiscounts[line.MedicineID]; ok {
+			line.DiscountPercent = discount
+			delete(lineDiscounts, line.MedicineID)
+		}
+
+		line.GrossAmount = roundAmount(float64(line.Quantity) * line.UnitPrice)
+		line.DiscountAmount = roundAmount(line.GrossAmount * line.DiscountPercent / 100)
+		// selling prices include GST like the MRP they cannot exceed, so the tax is taken out of the amount
+		line.Amount = roundAmount(line.GrossAmount - line.DiscountAmount)
+		line.TaxableAmount, line.CGSTAmount, line.SGSTAmount, line.IGSTAmount = splitInclusiveGST(line.Amount, line.TaxRate, inv.InterState)
+		line.TaxAmount = roundAmount(line.CGSTAmount + line.SGSTAmount + line.IGSTAmount)
+
+		inv.SubTotal += line.GrossAmount
+		inv.DiscountTotal += line.DiscountAmount
+		inv.CGSTTotal += line.CGSTAmount
+		inv.SGSTTotal += line.SGSTAmount
+		inv.IGSTTotal += line.IGSTAmount
+		inv.TaxTotal += line.TaxAmount
+		inv.Total += line.Amount
+	}
+	if len(lineDiscounts) > 0 {
+		return ErrNotInInvoice
+	}
+
+	inv.SubTotal = roundAmount(inv.SubTotal)
+	inv.DiscountTotal = roundAmount(inv.DiscountTotal)
+	inv.CGSTTotal = roundAmount(inv.CGSTTotal)
+	inv.SGSTTotal = roundAmount(inv.SGSTTotal)
+	inv.IGSTTotal = roundAmount(inv.IGSTTotal)
+	inv.TaxTotal = roundAmount(inv.TaxTotal)
+	inv.Total = roundAmount(inv.Total)
+	if charges.Notes != "" {
+		inv.Notes = charges.Notes
+	}
+	return nil
+}
+
+// invoiceLinesOfDeduction lists the medicines of the deduction at the prices it was made at,
+// with their current HSN codes and tax rates.
+func invoiceLinesOfDeduction(tx *gorm.DB, stockUpdationID int) ([]InvoiceLine, error) {
+	var lines []InvoiceLine
+	query := `
+		SELECT
+			sup.medicine_id,
+			m.name AS medicine,
+			sup.quantity,
+			sup.unit_price,
+			sup.mrp,
+			` + medicineTaxSQL + `
+		FROM
+			stock_updation_particulars sup
+		JOIN
+			medicines m
+		ON
+			sup.medicine_id = m.id
+		LEFT JOIN
+			med_types mt
+		ON
+			m.type_id = mt.id
+		WHERE
+			sup.stock_updation_id = ?
+		ORDER BY
+			m.name
+	`
+	err := tx.Raw(query, stockUpdationID).Scan(&lines).Error
+	return lines, err
+}
+
+// invoiceSource resolves the sale deduction to invoice and the patient it was for. Invoicing a visit
+// whose prescription is not dispensed yet dispenses it first. On insufficient stock the medicine id is returned.
+func invoiceSource(tx *gorm.DB, req *InvoiceRequest) (*StockUpdation, *int, error, int) {
+	stockUpdationID := 0
+	if req.VisitID != nil {
+		var visit Visit
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&visit, *req.VisitID).Error
+		if err != nil {
+			return nil, nil, err, 0
+		}
+		stockUpdationID, err = getVisitDeductionID(tx, visit.ID)
+		if err != nil {
+			return nil, nil, err, 0
+		}
+		if stockUpdationID == 0 {
+			deduction, err, insufficientMedID := dispenseVisitPrescriptions(tx, visit.ID, req.LocationID, req.AllowExpired)
+			if err != nil {
+				return nil, nil, err, insufficientMedID
+			}
+			stockUpdationID = deduction.StockUpdationID
+		}
+	} else if req.StockUpdationID != nil {
+		stockUpdationID = *req.StockUpdationID
+	} else {
+		return nil, nil, ErrInvoiceSourceUnset, 0
+	}
+
+	stockUpdation, err := lockStockUpdationForVoiding(tx, stockUpdationID)
+	if err == ErrInvoicedEntry {
+		return nil, nil, ErrAlreadyInvoiced, 0
+	}
+	if err != nil {
+		return nil, nil, err, 0
+	}
+	if stockUpdation.IsAddtion || stockUpdation.Kind != MovementSale {
+		return nil, nil, ErrNotASale, 0
+	}
+
+	patientID := req.PatientID
+	if stockUpdation.VisitID != nil {
+		var visit Visit
+		err = tx.Select("patient_id").First(&visit, *stockUpdation.VisitID).Error
+		if err != nil {
+			return nil, nil, err, 0
+		}
+		patientID = &visit.PatientID
+	} else if patientID != nil {
+		if _, err = GetPatientByID(tx, *patientID); err != nil {
+			return nil, nil, err, 0
+		}
+	}
+
+	return stockUpdation, patientID, nil, 0
+}
+
+// CreateInvoice bills a sale deduction, or the dispensing of a visit's prescription, as a draft invoice,
+// issuing it straight away when asked to. On insufficient stock the medicine id is returned.
+func CreateInvoice(db *gorm.DB, req *InvoiceRequest) (*Invoice, error, int) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error, 0
+	}
+
+	stockUpdation, patientID, err, insufficientMedID := invoiceSource(tx, req)
+	if err != nil {
+		tx.Rollback()
+		return nil, err, insufficientMedID
+	}
+
+	lines, err := invoiceLinesOfDeduction(tx, stockUpdation.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err, 0
+	}
+
+	invoice := &Invoice{
+		Status:          InvoiceDraft,
+		PatientID:       patientID,
+		VisitID:         stockUpdation.VisitID,
+		StockUpdationID: stockUpdation.ID,
+		Lines:           lines,
+	}
+	err = invoice.applyCharges(&req.InvoiceChargesRequest)
+	if err != nil {
+		tx.Rollback()
+		return nil, err, 0
+	}
+
+	err = tx.Create(invoice).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err, 0
+	}
+
+	if req.Issue {
+		err = issueInvoice(tx, invoice)
+		if err != nil {
+			tx.Rollback()
+			return nil, err, 0
+		}
+	}
+
+	return invoice, tx.Commit().Error, 0
+}
+
+// lockInvoice locks the invoice row and loads it with its lines.
+func lockInvoice(tx *gorm.DB, id int) (*Invoice, error) {
+	var invoice Invoice
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invoice, id).Error
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Where("invoice_id = ?", id).Order("id").Find(&invoice.Lines).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// UpdateInvoiceCharges changes the discounts, tax rate and notes of a draft invoice.
+func UpdateInvoiceCharges(db *gorm.DB, id int, charges *InvoiceChargesRequest) (*Invoice, error) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	invoice, err := lockInvoice(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if invoice.Status != InvoiceDraft {
+		tx.Rollback()
+		return nil, ErrInvoiceNotDraft
+	}
+
+	err = invoice.applyCharges(charges)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Omit("Lines").Save(invoice).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for i := range invoice.Lines {
+		err = tx.Save(&invoice.Lines[i]).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	return invoice, tx.Commit().Error
+}
+
+// issueInvoice gives the draft the next number of the current financial year. The counter row
+// is updated in the caller's transaction, so numbers have no gaps and are never handed out twice.
+func issueInvoice(tx *gorm.DB, invoice *Invoice) error {
+	now := time.Now()
+	year := financialYear(now)
+
+	var number int
+	err := tx.Raw(`
+		INSERT INTO invoice_sequences (financial_year, last_number) VALUES (?, 1)
+		ON CONFLICT (financial_year) DO UPDATE SET last_number = invoice_sequences.last_number + 1
+		RETURNING last_number
+	`, year).Scan(&number).Error
+	if err != nil {
+		return err
+	}
+
+	invoiceNo := fmt.Sprintf("INV/%s/%05d", year, number)
+	invoice.InvoiceNo = &invoiceNo
+	invoice.FinancialYear = year
+	invoice.Status = InvoiceIssued
+	invoice.IssuedAt = &now
+	err = tx.Model(&Invoice{}).Where("id = ?", invoice.ID).Updates(map[string]interface{}{
+		"invoice_no":     invoiceNo,
+		"financial_year": year,
+		"status":         InvoiceIssued,
+		"issued_at":      now,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	return refreshInvoicePayment(tx, invoice)
+}
+
+func IssueInvoice(db *gorm.DB, id int) (*Invoice, error) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	invoice, err := lockInvoice(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if invoice.Status != InvoiceDraft {
+		tx.Rollback()
+		return nil, ErrInvoiceNotDraft
+	}
+
+	err = issueInvoice(tx, invoice)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return invoice, tx.Commit().Error
+}
+
+// CancelInvoice cancels a draft or issued invoice and voids its stock deduction, which puts the
+// medicines back into the lots they were drawn from. An issued invoice keeps its number.
+func CancelInvoice(db *gorm.DB, id int, reason, cancelledBy string) (*Invoice, error) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	invoice, err := lockInvoice(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if invoice.Status == InvoiceCancelled {
+		tx.Rollback()
+		return nil, ErrInvoiceCancelled
+	}
+	if invoice.AmountPaid > 0 {
+		tx.Rollback()
+		return nil, ErrInvoicePaid
+	}
+
+	now := time.Now()
+	invoice.Status = InvoiceCancelled
+	invoice.CancelledAt = &now
+	invoice.CancelledBy = cancelledBy
+	invoice.CancelReason = reason
+	err = tx.Model(&Invoice{}).Where("id = ?", invoice.ID).Updates(map[string]interface{}{
+		"status":        InvoiceCancelled,
+		"cancelled_at":  now,
+		"cancelled_by":  cancelledBy,
+		"cancel_reason": reason,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	voidReason := "invoice cancelled"
+	if invoice.InvoiceNo != nil {
+		voidReason = fmt.Sprintf("invoice %s cancelled", *invoice.InvoiceNo)
+	}
+	if reason != "" {
+		voidReason += ": " + reason
+	}
+	_, err = voidStockUpdation(tx, invoice.StockUpdationID, voidReason, cancelledBy)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return invoice, tx.Commit().Error
+}
+
+// checkNotInvoiced fails when the stock updation is billed on an invoice that is not cancelled.
+func checkNotInvoiced(tx *gorm.DB, stockUpdationID int) error {
+	var invoice Invoice
+	err := tx.Select("id").Where("stock_updation_id = ? AND status <> ?", stockUpdationID, InvoiceCancelled).First(&invoice).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrInvoicedEntry
+}
+
+func GetInvoiceByID(db *gorm.DB, id int) (*Invoice, error) {
+	var invoice Invoice
+	err := db.Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).First(&invoice, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// GetAllInvoices lists invoices newest first, optionally of one status or patient.
+func GetAllInvoices(db *gorm.DB, status string, patientID, offset, limit int) ([]Invoice, error) {
+	invoices := []Invoice{}
+	query := db.Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).Order("created_at DESC, id DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if patientID != 0 {
+		query = query.Where("patient_id = ?", patientID)
+	}
+	err := query.Offset(offset).Limit(limit).Find(&invoices).Error
+	return invoices, err
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFinancialYear(t *testing.T) {
+	tests := []struct {
+		date time.Time
+		want string
+	}{
+		{time.Date(2025, time.April, 1, 0, 0, 0, 0, time.Local), "2025-26"},
+		{time.Date(2025, time.December, 31, 23, 59, 0, 0, time.Local), "2025-26"},
+		{time.Date(2026, time.January, 1, 0, 0, 0, 0, time.Local), "2025-26"},
+		{time.Date(2026, time.March, 31, 23, 59, 0, 0, time.Local), "2025-26"},
+		{time.Date(2026, time.April, 1, 0, 0, 0, 0, time.Local), "2026-27"},
+		{time.Date(2000, time.February, 1, 0, 0, 0, 0, time.Local), "1999-00"},
+		{time.Date(2099, time.May, 1, 0, 0, 0, 0, time.Local), "2099-00"},
+	}
+	for _, tt := range tests {
+		if got := financialYear(tt.date); got != tt.want {
+			t.Errorf("financialYear(%s) = %q, want %q", tt.date.Format("2006-01-02"), got, tt.want)
+		}
+	}
+}
+
+func TestRoundAmount(t *testing.T) {
+	tests := []struct {
+		amount, want float64
+	}{
+		{0, 0},
+		{1.004, 1},
+		{1.005, 1.01},
+		{2.675, 2.68},
+		{28.349999999, 28.35},
+		{-3.155, -3.16},
+	}
+	for _, tt := range tests {
+		if got := roundAmount(tt.amount); got != tt.want {
+			t.Errorf("roundAmount(%v) = %v, want %v", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestApplyCharges(t *testing.T) {
+	invoice := &Invoice{Lines: []InvoiceLine{
+		{MedicineID: 1, Quantity: 3, UnitPrice: 10.5, TaxRate: 12},
+		{MedicineID: 2, Quantity: 1, UnitPrice: 99.99, TaxRate: 5},
+		{MedicineID: 3, Quantity: 7, UnitPrice: 1.13, TaxRate: 0},
+	}}
+	charges := &InvoiceChargesRequest{
+		DiscountPercent: 10,
+		Lines:           []InvoiceLineChargeRequest{{MedicineID: 2, DiscountPercent: 0}},
+		Notes:           "regular patient",
+	}
+	if err := invoice.applyCharges(charges); err != nil {
+		t.Fatal(err)
+	}
+
+	wantLines := []struct {
+		gross, discountPercent, discount, amount, taxable, tax float64
+	}{
+		// 31.50 less 10%, the 12% GST taken out of 28.35
+		{31.5, 10, 3.15, 28.35, 25.31, 3.04},
+		// its own discount of 0 overrides the invoice's
+		{99.99, 0, 0, 99.99, 95.23, 4.76},
+		// 7.91 less 10% is 7.119, rounded to 0.79 off
+		{7.91, 10, 0.79, 7.12, 7.12, 0},
+	}
+	for i, want := range wantLines {
+		line := invoice.Lines[i]
+		if line.GrossAmount != want.gross || line.DiscountPercent != want.discountPercent || line.DiscountAmount != want.discount ||
+			line.Amount != want.amount || line.TaxableAmount != want.taxable || line.TaxAmount != want.tax {
+			t.Errorf("line %d: gross %v, discount %v%% %v, amount %v, taxable %v, tax %v, want %+v", i, line.GrossAmount,
+				line.DiscountPercent, line.DiscountAmount, line.Amount, line.TaxableAmount, line.TaxAmount, want)
+		}
+		if got := roundAmount(line.TaxableAmount + line.CGSTAmount + line.SGSTAmount + line.IGSTAmount); got != line.Amount {
+			t.Errorf("line %d: taxable and tax add up to %v, want the amount %v", i, got, line.Amount)
+		}
+	}
+
+	if invoice.SubTotal != 139.4 || invoice.DiscountTotal != 3.94 || invoice.TaxTotal != 7.8 || invoice.Total != 135.46 {
+		t.Errorf("totals: sub total %v, discount %v, tax %v, total %v, want 139.4, 3.94, 7.8, 135.46",
+			invoice.SubTotal, invoice.DiscountTotal, invoice.TaxTotal, invoice.Total)
+	}
+	if got := roundAmount(invoice.CGSTTotal + invoice.SGSTTotal + invoice.IGSTTotal); got != invoice.TaxTotal {
+		t.Errorf("CGST, SGST and IGST add up to %v, want the tax total %v", got, invoice.TaxTotal)
+	}
+	if invoice.IGSTTotal != 0 {
+		t.Errorf("IGST total is %v on an intra-state invoice", invoice.IGSTTotal)
+	}
+	if invoice.Notes != "regular patient" {
+		t.Errorf("notes = %q", invoice.Notes)
+	}
+}
+
+func TestApplyChargesInterState(t *testing.T) {
+	invoice := &Invoice{Lines: []InvoiceLine{{MedicineID: 1, Quantity: 2, UnitPrice: 56, TaxRate: 12}}}
+	if err := invoice.applyCharges(&InvoiceChargesRequest{InterState: true}); err != nil {
+		t.Fatal(err)
+	}
+	line := invoice.Lines[0]
+	if line.TaxableAmount != 100 || line.IGSTAmount != 12 || line.CGSTAmount != 0 || line.SGSTAmount != 0 {
+		t.Errorf("taxable %v, IGST %v, CGST %v, SGST %v, want 100, 12, 0, 0", line.TaxableAmount, line.IGSTAmount, line.CGSTAmount, line.SGSTAmount)
+	}
+	if invoice.IGSTTotal != 12 || invoice.Total != 112 {
+		t.Errorf("IGST total %v, total %v, want 12 and 112", invoice.IGSTTotal, invoice.Total)
+	}
+}
+
+func TestApplyChargesUnknownLine(t *testing.T) {
+	invoice := &Invoice{Lines: []InvoiceLine{{MedicineID: 1, Quantity: 1, UnitPrice: 10}}}
+	err := invoice.applyCharges(&InvoiceChargesRequest{Lines: []InvoiceLineChargeRequest{{MedicineID: 2, DiscountPercent: 5}}})
+	if err != ErrNotInInvoice {
+		t.Errorf("error = %v, want %v", err, ErrNotInInvoice)
+	}
+}
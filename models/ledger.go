@@ -0,0 +1,303 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Entry types of the stock ledger. Entries are never deleted: a reversal undoes a voided entry
+// and a correction posts the corrected lines of a voided entry. Adjustments come from stock takes.
+const (
+	EntryTypeRegular    = "regular"
+	EntryTypeReversal   = "reversal"
+	EntryTypeCorrection = "correction"
+	EntryTypeAdjustment = "adjustment"
+)
+
+var (
+	ErrAlreadyVoided       = fmt.Errorf("Stock updation is already voided")
+	ErrReversalNotVoidable = fmt.Errorf("Reversal entries cannot be voided or corrected")
+)
+
+func DeleteStockUpdation(db *gorm.DB, id int, req *VoidStockUpdationRequest) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	_, err := voidStockUpdation(tx, id, req.Reason, req.VoidedBy)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// UpdateParticularsInAnStockUpdation voids the stock updation and posts a correction entry with the new lines.
+// Returns the id of the correction entry.
+func UpdateParticularsInAnStockUpdation(db *gorm.DB, stockUpdationID int, req *UpdateStockUpdateRequest) (int, error, int) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return 0, tx.Error, 0
+	}
+
+	stockChanges := make([]StockAdditionChanges, len(req.StockChanges))
+	for i, stockChange := range req.StockChanges {
+		stockChanges[i] = StockAdditionChanges(stockChange)
+	}
+	err := convertStockAdditionChanges(tx, stockChanges)
+	if err != nil {
+		tx.Rollback()
+		return 0, err, 0
+	}
+
+	correctionID, err, insufficientMedID := correctStockUpdation(tx, stockUpdationID, stockChanges, req.AllowExpired, req.Reason, req.UpdatedBy)
+	if err != nil {
+		tx.Rollback()
+		return 0, err, insufficientMedID
+	}
+
+	return correctionID, tx.Commit().Error, 0
+}
+
+// lockStockUpdationForVoiding locks the stock updation row and checks that it can still be voided.
+func lockStockUpdationForVoiding(tx *gorm.DB, id int) (*StockUpdation, error) {
+	var stockUpdation StockUpdation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&stockUpdation).Error
+	if err != nil {
+		return nil, err
+	}
+	if stockUpdation.EntryType == EntryTypeReversal {
+		return nil, ErrReversalNotVoidable
+	}
+	if stockUpdation.TransferID != nil {
+		return nil, ErrTransferNotVoidable
+	}
+	if stockUpdation.VoidedAt != nil {
+		return nil, ErrAlreadyVoided
+	}
+	if err := checkNotInvoiced(tx, id); err != nil {
+		return nil, err
+	}
+	return &stockUpdation, nil
+}
+
+// voidStockUpdation marks the stock updation voided and posts a reversal entry that
+// undoes its effect on the lots and current stock. Returns the reversal entry.
+func voidStockUpdation(tx *gorm.DB, id int, reason, voidedBy string) (*StockUpdation, error) {
+	original, err := lockStockUpdationForVoiding(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var particulars []StockUpdationParticulars
+	err = tx.Where("stock_updation_id = ?", id).Find(&particulars).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var lotLines []StockUpdationLot
+	err = tx.Where("stock_updation_id = ?", id).Find(&lotLines).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if original.PurchaseOrderID != nil {
+		_, err = lockPurchaseOrder(tx, *original.PurchaseOrderID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	medicineIDs := []int{}
+	for i := range particulars {
+		medicineIDs = append(medicineIDs, particulars[i].MedicineID)
+	}
+	err = lockMedicines(tx, medicineIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	reversal := &StockUpdation{
+		IsAddtion:       original.IsAddtion,
+		BroughtAt:       time.Now(),
+		Kind:            original.Kind,
+		EntryType:       EntryTypeReversal,
+		ReferenceID:     &original.ID,
+		Reason:          reason,
+		LocationID:      original.LocationID,
+		SupplierID:      original.SupplierID,
+		PurchaseOrderID: original.PurchaseOrderID,
+		VisitID:         original.VisitID,
+	}
+	err = tx.Create(reversal).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range lotLines {
+		if original.IsAddtion {
+			err = takeFromLot(tx, lotLines[i].StockLotID, lotLines[i].Quantity)
+		} else {
+			err = putBackToLot(tx, lotLines[i].StockLotID, lotLines[i].Quantity)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Create(&StockUpdationLot{
+			StockUpdationID: reversal.ID,
+			StockLotID:      lotLines[i].StockLotID,
+			MedicineID:      lotLines[i].MedicineID,
+			Quantity:        lotLines[i].Quantity,
+			UnitCost:        lotLines[i].UnitCost,
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range particulars {
+		err = tx.Create(&StockUpdationParticulars{
+			StockUpdationID: reversal.ID,
+			MedicineID:      particulars[i].MedicineID,
+			Quantity:        particulars[i].Quantity,
+			UnitPrice:       particulars[i].UnitPrice,
+			MRP:             particulars[i].MRP,
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+
+		// adjusting stock to undo the stock updation
+		var stockChangeToDo int
+		if original.IsAddtion {
+			stockChangeToDo = -particulars[i].Quantity
+		} else {
+			stockChangeToDo = particulars[i].Quantity
+		}
+		var medicine Medicine
+		err = tx.Model(&medicine).Where("id = ?", particulars[i].MedicineID).Update("current_stock", gorm.Expr("current_stock + ?", stockChangeToDo)).Error
+		if isCheckViolation(err) {
+			return nil, ErrInsufficientStock
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = refreshLowStockAlerts(tx, medicineIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if original.PurchaseOrderID != nil {
+		err = adjustPurchaseOrderReceipt(tx, *original.PurchaseOrderID, particulars, -1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Model(&StockUpdation{}).Where("id = ?", original.ID).Updates(map[string]interface{}{
+		"voided_at":   time.Now(),
+		"voided_by":   voidedBy,
+		"void_reason": reason,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return reversal, nil
+}
+
+// correctStockUpdation voids the stock updation and posts the given lines as a correction entry
+// linked to the same supplier, purchase order or visit. Returns the correction entry id.
+func correctStockUpdation(tx *gorm.DB, id int, stockChanges []StockAdditionChanges, allowExpired bool, reason, correctedBy string) (int, error, int) {
+	original, err := lockStockUpdationForVoiding(tx, id)
+	if err != nil {
+		return 0, err, 0
+	}
+
+	if original.PurchaseOrderID != nil {
+		_, err = lockPurchaseOrder(tx, *original.PurchaseOrderID)
+		if err != nil {
+			return 0, err, 0
+		}
+	}
+
+	// lock the old and new medicines together so that the lock order stays ascending
+	var medicineIDs []int
+	err = tx.Model(&StockUpdationParticulars{}).Where("stock_updation_id = ?", id).Pluck("medicine_id", &medicineIDs).Error
+	if err != nil {
+		return 0, err, 0
+	}
+	for i := range stockChanges {
+		medicineIDs = append(medicineIDs, stockChanges[i].MedicineID)
+	}
+	err = lockMedicines(tx, medicineIDs)
+	if err != nil {
+		return 0, err, 0
+	}
+
+	_, err = voidStockUpdation(tx, id, reason, correctedBy)
+	if err != nil {
+		return 0, err, 0
+	}
+
+	correction := &StockUpdation{
+		IsAddtion:       original.IsAddtion,
+		BroughtAt:       time.Now(),
+		Kind:            original.Kind,
+		EntryType:       EntryTypeCorrection,
+		ReferenceID:     &original.ID,
+		Reason:          original.Reason,
+		LocationID:      original.LocationID,
+		SupplierID:      original.SupplierID,
+		PurchaseOrderID: original.PurchaseOrderID,
+		VisitID:         original.VisitID,
+	}
+	err = tx.Create(correction).Error
+	if err != nil {
+		return 0, err, 0
+	}
+
+	if original.IsAddtion {
+		err = addStockParticulars(tx, correction.ID, original.LocationID, stockChanges)
+		if err != nil {
+			return 0, err, 0
+		}
+		err = recordPurchaseTax(tx, correction)
+		if err != nil {
+			return 0, err, 0
+		}
+
+		if original.PurchaseOrderID != nil {
+			var particulars []StockUpdationParticulars
+			err = tx.Where("stock_updation_id = ?", correction.ID).Find(&particulars).Error
+			if err != nil {
+				return 0, err, 0
+			}
+			err = adjustPurchaseOrderReceipt(tx, *original.PurchaseOrderID, particulars, 1)
+			if err != nil {
+				return 0, err, 0
+			}
+		}
+		return correction.ID, nil, 0
+	}
+
+	deductions := make([]StockChanges, len(stockChanges))
+	for i := range stockChanges {
+		deductions[i] = stockChanges[i].StockChanges
+	}
+	allowExpired = allowExpired || original.Kind == MovementExpiredWriteOff
+	_, err, insufficientMedID := deductStockParticulars(tx, correction.ID, original.LocationID, deductions, allowExpired)
+	if err != nil {
+		return 0, err, insufficientMedID
+	}
+
+	return correction.ID, nil, 0
+}
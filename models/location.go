@@ -0,0 +1,320 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const DefaultLocationName = "Main store"
+
+var (
+	ErrUnknownLocation     = fmt.Errorf("Location does not exist")
+	ErrSameLocation        = fmt.Errorf("Transfer source and destination must be different locations")
+	ErrTransferNotVoidable = fmt.Errorf("Transfer entries cannot be voided or corrected, transfer the stock back instead")
+)
+
+// Location is a place stock is kept in, like the main store, the dispensing counter or a branch.
+// Stock additions and deductions happen at a location, and a location's stock is the balance of its lots.
+type Location struct {
+	ID          int       `json:"id" gorm:"column:id;primaryKey"`
+	Name        string    `json:"name" gorm:"column:name;unique"`
+	Description string    `json:"description" gorm:"column:description"`
+	IsDefault   bool      `json:"is_default" gorm:"column:is_default"` // used when a stock movement does not name a location
+	CreatedAt   time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+// StockTransfer moves stock between two locations as a deduction at the source and an addition
+// at the destination, drawn lot by lot so the batches and expiries travel with the stock.
+type StockTransfer struct {
+	ID             int       `json:"id" gorm:"column:id;primaryKey"`
+	FromLocationID int       `json:"from_location_id" gorm:"column:from_location_id"`
+	ToLocationID   int       `json:"to_location_id" gorm:"column:to_location_id"`
+	TransferredAt  time.Time `json:"transferred_at" gorm:"column:transferred_at"`
+	TransferredBy  string    `json:"transferred_by" gorm:"column:transferred_by"`
+	Notes          string    `json:"notes" gorm:"column:notes"`
+	DeductionID    *int      `json:"deduction_id" gorm:"column:deduction_id"` // stock updation taking the stock out of the source
+	AdditionID     *int      `json:"addition_id" gorm:"column:addition_id"`   // stock updation putting the stock into the destination
+
+	FromLocation Location `json:"-" gorm:"foreignKey:FromLocationID;references:ID"`
+	ToLocation   Location `json:"-" gorm:"foreignKey:ToLocationID;references:ID"`
+}
+
+func (l *Location) Create(db *gorm.DB) error {
+	l.ID = 0
+	err := db.Create(l).Error
+	if err != nil {
+		if err.Error() == "ERROR: duplicate key value violates unique constraint \"uni_locations_name\" (SQLSTATE 23505)" {
+			return ErrUniqueNameViolation
+		}
+		return err
+	}
+	return nil
+}
+
+func (l *Location) Update(db *gorm.DB) error {
+	result := db.Model(&Location{}).Where("id = ?", l.ID).Updates(map[string]interface{}{
+		"name":        l.Name,
+		"description": l.Description,
+	})
+	if result.Error != nil {
+		if result.Error.Error() == "ERROR: duplicate key value violates unique constraint \"uni_locations_name\" (SQLSTATE 23505)" {
+			return ErrUniqueNameViolation
+		}
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func GetAllLocations(db *gorm.DB) ([]Location, error) {
+	var locations []Location
+	err := db.Order("id").Find(&locations).Error
+	return locations, err
+}
+
+func GetLocationByID(db *gorm.DB, id int) (*Location, error) {
+	var location Location
+	err := db.First(&location, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+// resolveLocationID returns the default location for 0 and checks that any other location exists.
+func resolveLocationID(tx *gorm.DB, locationID int) (int, error) {
+	var location Location
+	query := tx.Select("id")
+	if locationID == 0 {
+		query = query.Where("is_default").Order("id")
+	} else {
+		query = query.Where("id = ?", locationID)
+	}
+	err := query.First(&location).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrUnknownLocation
+	}
+	if err != nil {
+		return 0, err
+	}
+	return location.ID, nil
+}
+
+// BackfillLocations creates the default location on first run and puts the lots, stock updations
+// and stock takes recorded before locations existed into it.
+func BackfillLocations(db *gorm.DB) error {
+	var count int64
+	err := db.Model(&Location{}).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		err = db.Create(&Location{Name: DefaultLocationName, IsDefault: true}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	locationID, err := resolveLocationID(db, 0)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"stock_lots", "stock_updations", "stock_takes"} {
+		err = db.Exec("UPDATE "+table+" SET location_id = ? WHERE location_id IS NULL", locationID).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	// batches are unique per location now, the index on medicine and batch alone predates that
+	if db.Migrator().HasIndex(&StockLot{}, "idx_stock_lots_medicine_batch") {
+		return db.Migrator().DropIndex(&StockLot{}, "idx_stock_lots_medicine_batch")
+	}
+	return nil
+}
+
+// GetLocationStock lists the stock of every medicine held at the location, from its lot balances.
+func GetLocationStock(db *gorm.DB, locationID int) ([]response.LocationStock, error) {
+	stock := []response.LocationStock{}
+	query := `
+		SELECT
+			m.id AS medicine_id,
+			m.name AS medicine,
+			m.base_unit,
+			SUM(sl.quantity) AS quantity,
+			COALESCE(SUM(sl.quantity) FILTER (WHERE sl.expires_at <= NOW()), 0) AS expired_quantity
+		FROM
+			stock_lots sl
+		JOIN
+			medicines m
+		ON
+			sl.medicine_id = m.id
+		WHERE
+			sl.location_id = ?
+			AND sl.quantity > 0
+		GROUP BY
+			m.id, m.name, m.base_unit
+		ORDER BY
+			m.name
+	`
+	err := db.Raw(query, locationID).Scan(&stock).Error
+	if err != nil {
+		return nil, err
+	}
+
+	medicineIDs := make([]int, len(stock))
+	for i := range stock {
+		medicineIDs[i] = stock[i].MedicineID
+	}
+	unitsByMedicine, err := getUnitsByMedicineIDs(db, medicineIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range stock {
+		stock[i].QuantityInPacks = FormatPacks(stock[i].Quantity, stock[i].BaseUnit, unitsByMedicine[stock[i].MedicineID])
+	}
+
+	return stock, nil
+}
+
+// getLocationStockQuantity is the balance of the medicine's lots at the location.
+func getLocationStockQuantity(tx *gorm.DB, locationID, medicineID int) (int, error) {
+	var quantity int
+	err := tx.Raw("SELECT COALESCE(SUM(quantity), 0) FROM stock_lots WHERE location_id = ? AND medicine_id = ?", locationID, medicineID).Scan(&quantity).Error
+	return quantity, err
+}
+
+// TransferStock moves the quantities from one location to another in a single transaction. The stock leaves
+// the source first-expiry-first-out and lands in the destination in the same batches. On insufficient
+// stock at the source the medicine id is returned.
+func TransferStock(db *gorm.DB, req *StockTransferRequest) (*StockTransfer, error, int) {
+	if req.FromLocationID == req.ToLocationID {
+		return nil, ErrSameLocation, 0
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error, 0
+	}
+
+	for _, locationID := range []int{req.FromLocationID, req.ToLocationID} {
+		if _, err := resolveLocationID(tx, locationID); err != nil {
+			tx.Rollback()
+			return nil, err, 0
+		}
+	}
+
+	err := convertStockChanges(tx, req.StockChanges)
+	if err != nil {
+		tx.Rollback()
+		return nil, err, 0
+	}
+
+	transfer := &StockTransfer{
+		FromLocationID: req.FromLocationID,
+		ToLocationID:   req.ToLocationID,
+		TransferredAt:  time.Now(),
+		TransferredBy:  req.TransferredBy,
+		Notes:          req.Notes,
+	}
+	err = tx.Create(transfer).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err, 0
+	}
+
+	deduction := &StockUpdation{
+		BroughtAt:  transfer.TransferredAt,
+		IsAddtion:  false,
+		Kind:       MovementTransferOut,
+		LocationID: req.FromLocationID,
+		TransferID: &transfer.ID,
+		Reason:     req.Notes,
+	}
+	err = tx.Create(deduction).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err, 0
+	}
+
+	allocations, err, insufficientMedID := deductStockParticulars(tx, deduction.ID, req.FromLocationID, req.StockChanges, req.AllowExpired)
+	if err != nil {
+		tx.Rollback()
+		return nil, err, insufficientMedID
+	}
+
+	additions := make([]StockAdditionChanges, len(allocations))
+	for i, allocation := range allocations {
+		var lot StockLot
+		err = tx.Select("manufactured_at", "unit_cost").First(&lot, allocation.StockLotID).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, err, 0
+		}
+		additions[i] = StockAdditionChanges{
+			StockChanges:   StockChanges{MedicineID: allocation.MedicineID, Quantity: allocation.Quantity},
+			UnitCost:       lot.UnitCost,
+			BatchNo:        allocation.BatchNo,
+			ManufacturedAt: lot.ManufacturedAt,
+			ExpiresAt:      allocation.ExpiresAt,
+		}
+	}
+
+	addition := &StockUpdation{
+		BroughtAt:  transfer.TransferredAt,
+		IsAddtion:  true,
+		Kind:       MovementTransferIn,
+		LocationID: req.ToLocationID,
+		TransferID: &transfer.ID,
+		Reason:     req.Notes,
+	}
+	err = tx.Create(addition).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err, 0
+	}
+
+	err = addStockParticulars(tx, addition.ID, req.ToLocationID, additions)
+	if err != nil {
+		tx.Rollback()
+		return nil, err, 0
+	}
+
+	transfer.DeductionID = &deduction.ID
+	transfer.AdditionID = &addition.ID
+	err = tx.Model(transfer).Updates(map[string]interface{}{
+		"deduction_id": deduction.ID,
+		"addition_id":  addition.ID,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err, 0
+	}
+
+	return transfer, tx.Commit().Error, 0
+}
+
+func GetAllStockTransfers(db *gorm.DB, locationID, offset, limit int) ([]StockTransfer, error) {
+	var transfers []StockTransfer
+	query := db.Order("transferred_at DESC, id DESC")
+	if locationID != 0 {
+		query = query.Where("from_location_id = ? OR to_location_id = ?", locationID, locationID)
+	}
+	err := query.Offset(offset).Limit(limit).Find(&transfers).Error
+	return transfers, err
+}
+
+func GetStockTransferByID(db *gorm.DB, id int) (*StockTransfer, error) {
+	var transfer StockTransfer
+	err := db.First(&transfer, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
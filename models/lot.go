@@ -0,0 +1,347 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OpeningLotBatchNo is the batch of the lot holding stock recorded before stock was kept in lots.
+// Its expiry is not known, so it is set far ahead and a stock take can correct it.
+const OpeningLotBatchNo = "OPENING"
+
+var openingLotExpiry = time.Date(2099, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+var (
+	ErrMissingBatchDetails = fmt.Errorf("Batch number, manufacture date and expiry date are required for stock additions")
+	ErrBatchExpiryMismatch = fmt.Errorf("Batch already exists with a different expiry date")
+	ErrOnlyExpiredStock    = fmt.Errorf("Only expired stock is available, pass allow_expired to dispense it")
+)
+
+// addToLot puts the quantity of a stock addition into the lot of its batch at the location,
+// creating the lot when the batch is new there, and averages its unit cost into the lot's.
+// Returns the lot id and the unit cost of the quantity added.
+func addToLot(tx *gorm.DB, locationID int, change StockAdditionChanges) (int, float64, error) {
+	if change.BatchNo == "" || change.ManufacturedAt.IsZero() || change.ExpiresAt.IsZero() {
+		return 0, 0, ErrMissingBatchDetails
+	}
+
+	var lot StockLot
+	err := tx.Where("location_id = ? AND medicine_id = ? AND batch_no = ?", locationID, change.MedicineID, change.BatchNo).First(&lot).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		lot = StockLot{
+			LocationID:     locationID,
+			MedicineID:     change.MedicineID,
+			BatchNo:        change.BatchNo,
+			ManufacturedAt: change.ManufacturedAt,
+			ExpiresAt:      change.ExpiresAt,
+			Quantity:       change.Quantity,
+			UnitCost:       change.UnitCost,
+		}
+		if err := tx.Create(&lot).Error; err != nil {
+			return 0, 0, err
+		}
+		return lot.ID, lot.UnitCost, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !lot.ExpiresAt.Equal(change.ExpiresAt) {
+		return 0, 0, ErrBatchExpiryMismatch
+	}
+
+	unitCost := change.UnitCost
+	if unitCost == 0 {
+		unitCost = lot.UnitCost
+	}
+	lotCost := lot.UnitCost
+	if lot.Quantity+change.Quantity > 0 {
+		lotCost = (float64(lot.Quantity)*lot.UnitCost + float64(change.Quantity)*unitCost) / float64(lot.Quantity+change.Quantity)
+	}
+
+	err = tx.Model(&StockLot{}).Where("id = ?", lot.ID).Updates(map[string]interface{}{
+		"quantity":  gorm.Expr("quantity + ?", change.Quantity),
+		"unit_cost": lotCost,
+	}).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	return lot.ID, unitCost, nil
+}
+
+// takeFromLot removes quantity from a lot, failing if the lot does not hold enough.
+func takeFromLot(tx *gorm.DB, lotID, quantity int) error {
+	result := tx.Model(&StockLot{}).Where("id = ? AND quantity >= ?", lotID, quantity).Update("quantity", gorm.Expr("quantity - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+func putBackToLot(tx *gorm.DB, lotID, quantity int) error {
+	return tx.Model(&StockLot{}).Where("id = ?", lotID).Update("quantity", gorm.Expr("quantity + ?", quantity)).Error
+}
+
+// addStockParticulars records the lines of a stock addition against their lots at the location,
+// keeps one particulars row per medicine and adds the quantities to the current stock.
+func addStockParticulars(tx *gorm.DB, stockUpdationID, locationID int, stockChanges []StockAdditionChanges) error {
+	medicineIDs := make([]int, len(stockChanges))
+	for i := range stockChanges {
+		medicineIDs[i] = stockChanges[i].MedicineID
+	}
+	// same lock order as deductions, so an addition of several medicines cannot deadlock against them
+	err := lockMedicines(tx, medicineIDs)
+	if err != nil {
+		return err
+	}
+
+	medicineOrder := []int{}
+	medicineQuantities := make(map[int]int)
+	lotQuantities := make(map[int]*StockUpdationLot)
+	lotCosts := make(map[int]float64)
+	lotOrder := []int{}
+
+	for _, stockChange := range stockChanges {
+		lotID, unitCost, err := addToLot(tx, locationID, stockChange)
+		if err != nil {
+			return err
+		}
+		lotCosts[lotID] += float64(stockChange.Quantity) * unitCost
+
+		if _, ok := lotQuantities[lotID]; !ok {
+			lotQuantities[lotID] = &StockUpdationLot{
+				StockUpdationID: stockUpdationID,
+				StockLotID:      lotID,
+				MedicineID:      stockChange.MedicineID,
+			}
+			lotOrder = append(lotOrder, lotID)
+		}
+		lotQuantities[lotID].Quantity += stockChange.Quantity
+
+		if _, ok := medicineQuantities[stockChange.MedicineID]; !ok {
+			medicineOrder = append(medicineOrder, stockChange.MedicineID)
+		}
+		medicineQuantities[stockChange.MedicineID] += stockChange.Quantity
+	}
+
+	for _, lotID := range lotOrder {
+		if lotQuantities[lotID].Quantity > 0 {
+			lotQuantities[lotID].UnitCost = lotCosts[lotID] / float64(lotQuantities[lotID].Quantity)
+		}
+		if err := tx.Create(lotQuantities[lotID]).Error; err != nil {
+			return err
+		}
+	}
+
+	prices, err := getPricesInForce(tx, medicineOrder, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, medicineID := range medicineOrder {
+		stockUpdationParticulars := &StockUpdationParticulars{
+			StockUpdationID: stockUpdationID,
+			MedicineID:      medicineID,
+			Quantity:        medicineQuantities[medicineID],
+			UnitPrice:       prices[medicineID].SellingPrice,
+			MRP:             prices[medicineID].MRP,
+		}
+		err := tx.Create(stockUpdationParticulars).Error
+		if err != nil {
+			return err
+		}
+
+		//add quantity to Medicine.CurrentStock
+		var medicine Medicine
+		err = tx.Model(&medicine).Where("id = ?", medicineID).Update("current_stock", gorm.Expr("current_stock + ?", medicineQuantities[medicineID])).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return refreshLowStockAlerts(tx, medicineOrder)
+}
+
+// deductStockParticulars deducts each medicine from its lots at the location in first-expiry-first-out order,
+// records the lots drawn and reduces the current stock. On insufficient stock the medicine id is returned.
+func deductStockParticulars(tx *gorm.DB, stockUpdationID, locationID int, stockChanges []StockChanges, allowExpired bool) ([]response.StockUpdationLotDetails, error, int) {
+	medicineOrder := []int{}
+	medicineQuantities := make(map[int]int)
+	for _, stockChange := range stockChanges {
+		if _, ok := medicineQuantities[stockChange.MedicineID]; !ok {
+			medicineOrder = append(medicineOrder, stockChange.MedicineID)
+		}
+		medicineQuantities[stockChange.MedicineID] += stockChange.Quantity
+	}
+
+	err := lockMedicines(tx, medicineOrder)
+	if err != nil {
+		return nil, err, 0
+	}
+
+	prices, err := getPricesInForce(tx, medicineOrder, time.Now())
+	if err != nil {
+		return nil, err, 0
+	}
+
+	allocations := []response.StockUpdationLotDetails{}
+	for _, medicineID := range medicineOrder {
+		quantity := medicineQuantities[medicineID]
+
+		stockUpdationParticulars := &StockUpdationParticulars{
+			StockUpdationID: stockUpdationID,
+			MedicineID:      medicineID,
+			Quantity:        quantity,
+			UnitPrice:       prices[medicineID].SellingPrice,
+			MRP:             prices[medicineID].MRP,
+		}
+		err = tx.Create(stockUpdationParticulars).Error
+		if err != nil {
+			return nil, err, 0
+		}
+
+		//get current stock, the medicine row is locked so no other deduction can change it meanwhile
+		var currentStock int
+		err = tx.Raw("SELECT current_stock FROM medicines WHERE id = ?", medicineID).Scan(&currentStock).Error
+		if err != nil {
+			return nil, err, 0
+		}
+
+		if currentStock < quantity {
+			return nil, ErrInsufficientStock, medicineID
+		}
+
+		medicineAllocations, err := allocateFromLots(tx, stockUpdationID, locationID, medicineID, quantity, allowExpired)
+		if err != nil {
+			if err == ErrInsufficientStock || err == ErrOnlyExpiredStock {
+				return nil, err, medicineID
+			}
+			return nil, err, 0
+		}
+		allocations = append(allocations, medicineAllocations...)
+
+		//deduct quantity from Medicine.CurrentStock
+		var medicine Medicine
+		err = tx.Model(&medicine).Where("id = ?", medicineID).Update("current_stock", gorm.Expr("current_stock - ?", quantity)).Error
+		if isCheckViolation(err) {
+			return nil, ErrInsufficientStock, medicineID
+		}
+		if err != nil {
+			return nil, err, 0
+		}
+	}
+
+	err = refreshLowStockAlerts(tx, medicineOrder)
+	if err != nil {
+		return nil, err, 0
+	}
+
+	return allocations, nil, 0
+}
+
+// allocateFromLots draws quantity from the earliest-expiring lots of a medicine at the location.
+// Expired lots are skipped unless allowExpired is set.
+func allocateFromLots(tx *gorm.DB, stockUpdationID, locationID, medicineID, quantity int, allowExpired bool) ([]response.StockUpdationLotDetails, error) {
+	var lots []StockLot
+	query := tx.Where("location_id = ? AND medicine_id = ? AND quantity > 0", locationID, medicineID)
+	if !allowExpired {
+		query = query.Where("expires_at > ?", time.Now())
+	}
+	err := query.Order("expires_at, id").Find(&lots).Error
+	if err != nil {
+		return nil, err
+	}
+
+	allocations := []response.StockUpdationLotDetails{}
+	remaining := quantity
+	for i := range lots {
+		if remaining == 0 {
+			break
+		}
+
+		drawn := min(lots[i].Quantity, remaining)
+		err = takeFromLot(tx, lots[i].ID, drawn)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Create(&StockUpdationLot{
+			StockUpdationID: stockUpdationID,
+			StockLotID:      lots[i].ID,
+			MedicineID:      medicineID,
+			Quantity:        drawn,
+			UnitCost:        lots[i].UnitCost,
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+
+		allocations = append(allocations, response.StockUpdationLotDetails{
+			StockLotID: lots[i].ID,
+			MedicineID: medicineID,
+			BatchNo:    lots[i].BatchNo,
+			ExpiresAt:  lots[i].ExpiresAt,
+			Quantity:   drawn,
+			UnitCost:   lots[i].UnitCost,
+		})
+		remaining -= drawn
+	}
+
+	if remaining > 0 {
+		if !allowExpired {
+			var expiredQuantity int
+			err = tx.Raw("SELECT COALESCE(SUM(quantity), 0) FROM stock_lots WHERE location_id = ? AND medicine_id = ? AND expires_at <= ?", locationID, medicineID, time.Now()).Scan(&expiredQuantity).Error
+			if err != nil {
+				return nil, err
+			}
+			if expiredQuantity >= remaining {
+				return nil, ErrOnlyExpiredStock
+			}
+		}
+		return nil, ErrInsufficientStock
+	}
+
+	return allocations, nil
+}
+
+// GetStockLotsByMedicineID lists the lots of a medicine, at all locations when locationID is 0.
+func GetStockLotsByMedicineID(db *gorm.DB, medicineID, locationID int, includeEmpty bool) ([]StockLot, error) {
+	var lots []StockLot
+	query := db.Where("medicine_id = ?", medicineID)
+	if locationID != 0 {
+		query = query.Where("location_id = ?", locationID)
+	}
+	if !includeEmpty {
+		query = query.Where("quantity > 0")
+	}
+	err := query.Order("expires_at, id").Find(&lots).Error
+	return lots, err
+}
+
+// BackfillOpeningLots puts the current stock of each medicine that no lot covers, stock recorded before
+// lots existed, into an opening lot at the default location, so that it can be sold. It runs once per
+// medicine, a medicine that already has an opening lot is left alone.
+func BackfillOpeningLots(db *gorm.DB) error {
+	locationID, err := resolveLocationID(db, 0)
+	if err != nil {
+		return err
+	}
+	return db.Exec(`
+		INSERT INTO stock_lots (location_id, medicine_id, batch_no, manufactured_at, expires_at, quantity, unit_cost, created_at)
+		SELECT ?, m.id, ?, m.created_at, ?, m.current_stock - COALESCE(lots.quantity, 0), COALESCE(m.cost_price, 0), NOW()
+		FROM medicines m
+		LEFT JOIN (
+			SELECT medicine_id, SUM(quantity) AS quantity FROM stock_lots GROUP BY medicine_id
+		) lots ON lots.medicine_id = m.id
+		WHERE m.current_stock > COALESCE(lots.quantity, 0)
+			AND NOT EXISTS (SELECT 1 FROM stock_lots sl WHERE sl.medicine_id = m.id AND sl.batch_no = ?)
+		ON CONFLICT DO NOTHING
+	`, locationID, OpeningLotBatchNo, openingLotExpiry, OpeningLotBatchNo).Error
+}
@@ -14,58 +14,175 @@ type Medicine struct {
 	Name         string    `json:"name" gorm:"column:name;unique" validate:"required"`
 	Description  string    `json:"description" gorm:"column:description"`
 	TypeID       int       `json:"typeId" gorm:"column:type_id" validate:"required,gte=1"`
-	Price        float64   `json:"price" gorm:"column:price" validate:"required,gte=0"`
+	Price        float64   `json:"price" gorm:"column:price" validate:"required,gte=0"` // selling price
+	CostPrice    float64   `json:"cost_price" gorm:"column:cost_price" validate:"gte=0"`
+	MRP          float64   `json:"mrp" gorm:"column:mrp" validate:"gte=0"`
+	HSNCode      string    `json:"hsn_code" gorm:"column:hsn_code"` // the type's when empty
+	TaxRate      *float64  `json:"tax_rate" gorm:"column:tax_rate"` // GST rate in percent, the type's when not set
 	MinStock     int       `json:"min_stock" gorm:"column:min_stock" validate:"required,gte=0"`
 	OptimalStock int       `json:"optimal_stock" gorm:"column:optimal_stock" validate:"required,gte=0"`
-	CurrentStock int       `json:"current_stock" gorm:"column:current_stock;default:0" validate:"gte=0"`
+	CurrentStock int       `json:"current_stock" gorm:"column:current_stock;default:0;check:chk_medicines_current_stock,current_stock >= 0" validate:"gte=0"`
+	BaseUnit     string    `json:"base_unit" gorm:"column:base_unit;default:unit"` // the unit stock, prices and levels are kept in
 	CreatedAt    time.Time `json:"created_at" gorm:"column:created_at"`
 	UpdatedAt    time.Time `json:"updated_at" gorm:"column:updated_at"`
 
-	Type MedType `json:"-" gorm:"foreignKey:TypeID;references:ID"`
+	PreferredSupplierID *int `json:"preferred_supplier_id" gorm:"column:preferred_supplier_id"`
+
+	Units        []MedicineUnit `json:"units" gorm:"foreignKey:MedicineID;constraint:OnDelete:CASCADE"`
+	StockInPacks string         `json:"stock_in_packs" gorm:"-"`
+
+	Type              MedType   `json:"-" gorm:"foreignKey:TypeID;references:ID"`
+	PreferredSupplier *Supplier `json:"-" gorm:"foreignKey:PreferredSupplierID;references:ID"`
 }
 
 type MedType struct {
-	ID   int    `json:"id" gorm:"column:id;primaryKey"`
-	Type string `json:"type" gorm:"column:type;unique" validate:"required"`
+	ID      int     `json:"id" gorm:"column:id;primaryKey"`
+	Type    string  `json:"type" gorm:"column:type;unique" validate:"required"`
+	HSNCode string  `json:"hsn_code" gorm:"column:hsn_code"`                            // default HSN code of medicines of the type
+	TaxRate float64 `json:"tax_rate" gorm:"column:tax_rate;default:0" validate:"gte=0"` // default GST rate of medicines of the type
 }
 
 // Model methods for database operations
 func (m *Medicine) Create(db *gorm.DB) error {
-	err := db.Create(m).Error
+	if err := m.normaliseUnits(); err != nil {
+		return err
+	}
+	if err := checkPrices(m.Price, m.MRP); err != nil {
+		return err
+	}
+	if err := checkTaxRate(m.TaxRate); err != nil {
+		return err
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	err := tx.Create(m).Error
 	if err != nil {
+		tx.Rollback()
 		if err.Error() == "ERROR: duplicate key value violates unique constraint \"uni_medicines_name\" (SQLSTATE 23505)" {
 			return ErrUniqueNameViolation
 		} else {
 			return err
 		}
 	}
-	return nil
+
+	err = recordPrice(tx, &MedicinePrice{
+		MedicineID:    m.ID,
+		CostPrice:     m.CostPrice,
+		MRP:           m.MRP,
+		SellingPrice:  m.Price,
+		EffectiveFrom: m.CreatedAt,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
 }
 
+// Update saves the medicine's details, leaving its stock alone. Its units are replaced only when Units
+// is given, and prices that differ from the current ones are recorded as a price change from now.
 func (m *Medicine) Update(db *gorm.DB) error {
-	err := db.Save(m).Error
+	if err := m.normaliseUnits(); err != nil {
+		return err
+	}
+	if err := checkPrices(m.Price, m.MRP); err != nil {
+		return err
+	}
+	if err := checkTaxRate(m.TaxRate); err != nil {
+		return err
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	err := lockMedicines(tx, []int{m.ID})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	current, err := GetMedicineByID(tx, m.ID)
 	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Model(&Medicine{ID: m.ID}).
+		Select("name", "description", "type_id", "min_stock", "optimal_stock", "base_unit", "preferred_supplier_id", "hsn_code", "tax_rate", "updated_at").
+		Updates(m).Error
+	if err != nil {
+		tx.Rollback()
 		if err.Error() == "ERROR: duplicate key value violates unique constraint \"uni_medicines_name\" (SQLSTATE 23505)" {
 			return ErrUniqueNameViolation
 		} else {
 			return err
 		}
 	}
-	return nil
+
+	if current.Price != m.Price || current.CostPrice != m.CostPrice || current.MRP != m.MRP {
+		err = recordPrice(tx, &MedicinePrice{
+			MedicineID:   m.ID,
+			CostPrice:    m.CostPrice,
+			MRP:          m.MRP,
+			SellingPrice: m.Price,
+		})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if m.Units != nil {
+		err = tx.Where("medicine_id = ?", m.ID).Delete(&MedicineUnit{}).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for i := range m.Units {
+			m.Units[i].ID = 0
+			m.Units[i].MedicineID = m.ID
+		}
+		if len(m.Units) > 0 {
+			err = tx.Create(&m.Units).Error
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	updated, err := GetMedicineByID(tx, m.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	*m = *updated
+
+	return tx.Commit().Error
 }
 
 func GetMedicineByID(db *gorm.DB, id int) (*Medicine, error) {
 	var medicine Medicine
-	err := db.First(&medicine, id).Error
+	err := db.Preload("Units").First(&medicine, id).Error
 	if err != nil {
 		return nil, err
 	}
+	medicine.setStockInPacks()
 	return &medicine, nil
 }
 
 func GetAllMedicines(db *gorm.DB) ([]Medicine, error) {
 	var medicines []Medicine
-	err := db.Find(&medicines).Error
+	err := db.Preload("Units").Find(&medicines).Error
+	for i := range medicines {
+		medicines[i].setStockInPacks()
+	}
 	return medicines, err
 }
 
@@ -90,6 +207,9 @@ func GetMedTypeByID(db *gorm.DB, id int) (*MedType, error) {
 
 func (m *MedType) Create(db *gorm.DB) error {
 	m.ID = 0 //To prevent id from being set by the client
+	if err := checkTaxRate(&m.TaxRate); err != nil {
+		return err
+	}
 	err := db.Create(m).Error
 	if err != nil {
 		if err.Error() == "ERROR: duplicate key value violates unique constraint \"uni_med_types_type\" (SQLSTATE 23505)" {
@@ -102,7 +222,10 @@ func (m *MedType) Create(db *gorm.DB) error {
 }
 
 func (m *MedType) Update(db *gorm.DB) error {
-	result := db.Exec("UPDATE med_types SET type = ? WHERE id = ?", m.Type, m.ID)
+	if err := checkTaxRate(&m.TaxRate); err != nil {
+		return err
+	}
+	result := db.Exec("UPDATE med_types SET type = ?, hsn_code = ?, tax_rate = ? WHERE id = ?", m.Type, m.HSNCode, m.TaxRate, m.ID)
 	if result.Error != nil {
 		if result.Error.Error() == "ERROR: duplicate key value violates unique constraint \"uni_med_types_type\" (SQLSTATE 23505)" {
 			return ErrUniqueNameViolation
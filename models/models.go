@@ -6,16 +6,40 @@ type StockUpdation struct {
 	ID        int       `json:"id" gorm:"column:id;primaryKey"`
 	IsAddtion bool      `json:"is_addition" gorm:"column:is_addition"`
 	BroughtAt time.Time `json:"brought_at" gorm:"column:brought_at"`
+	Kind      string    `json:"kind" gorm:"column:kind;index"`
+
+	LocationID int  `json:"location_id" gorm:"column:location_id;index"`
+	TransferID *int `json:"transfer_id" gorm:"column:transfer_id"` // set on both entries of a stock transfer
+
+	SupplierID      *int `json:"supplier_id" gorm:"column:supplier_id"`
+	PurchaseOrderID *int `json:"purchase_order_id" gorm:"column:purchase_order_id"`
+	VisitID         *int `json:"visit_id" gorm:"column:visit_id;index"` // set when the deduction dispenses a visit's prescription
+
+	EntryType   string     `json:"entry_type" gorm:"column:entry_type;default:regular"`
+	ReferenceID *int       `json:"reference_id" gorm:"column:reference_id"` // the entry a reversal or correction refers to
+	VoidedAt    *time.Time `json:"voided_at" gorm:"column:voided_at"`
+	VoidedBy    string     `json:"voided_by" gorm:"column:voided_by"`
+	VoidReason  string     `json:"void_reason" gorm:"column:void_reason"`
+	Reason      string     `json:"reason" gorm:"column:reason"`
+
+	Supplier      *Supplier      `json:"-" gorm:"foreignKey:SupplierID;references:ID"`
+	PurchaseOrder *PurchaseOrder `json:"-" gorm:"foreignKey:PurchaseOrderID;references:ID"`
+	Visit         *Visit         `json:"-" gorm:"foreignKey:VisitID;references:ID"`
+	Location      *Location      `json:"-" gorm:"foreignKey:LocationID;references:ID"`
 }
 
 func (s *StockUpdation) TableName() string {
 	return "stock_updations"
 }
 
+// StockUpdationParticulars holds the total quantity of a medicine moved in a stock updation, with the
+// selling price and MRP in force then. The lot-wise split of that quantity is kept in StockUpdationLot.
 type StockUpdationParticulars struct {
-	StockUpdationID int `json:"stock_updation_id" gorm:"column:stock_updation_id;primaryKey"`
-	MedicineID      int `json:"medicine_id" gorm:"column:medicine_id;primaryKey"`
-	Quantity        int `json:"quantity" gorm:"column:quantity;primaryKey"`
+	StockUpdationID int     `json:"stock_updation_id" gorm:"column:stock_updation_id;primaryKey"`
+	MedicineID      int     `json:"medicine_id" gorm:"column:medicine_id;primaryKey"`
+	Quantity        int     `json:"quantity" gorm:"column:quantity;primaryKey"`
+	UnitPrice       float64 `json:"unit_price" gorm:"column:unit_price"`
+	MRP             float64 `json:"mrp" gorm:"column:mrp"`
 
 	Medicine      Medicine      `json:"-" gorm:"foreignKey:MedicineID;references:ID"`
 	StockUpdation StockUpdation `json:"-" gorm:"foreignKey:StockUpdationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
@@ -24,3 +48,40 @@ type StockUpdationParticulars struct {
 func (s *StockUpdationParticulars) TableName() string {
 	return "stock_updation_particulars"
 }
+
+// StockLot is a batch of a medicine at a location with its own expiry. Quantity is the balance left in the lot.
+type StockLot struct {
+	ID             int       `json:"id" gorm:"column:id;primaryKey"`
+	LocationID     int       `json:"location_id" gorm:"column:location_id;uniqueIndex:idx_stock_lots_location_medicine_batch"`
+	MedicineID     int       `json:"medicine_id" gorm:"column:medicine_id;uniqueIndex:idx_stock_lots_location_medicine_batch"`
+	BatchNo        string    `json:"batch_no" gorm:"column:batch_no;uniqueIndex:idx_stock_lots_location_medicine_batch"`
+	ManufacturedAt time.Time `json:"manufactured_at" gorm:"column:manufactured_at"`
+	ExpiresAt      time.Time `json:"expires_at" gorm:"column:expires_at;index"`
+	Quantity       int       `json:"quantity" gorm:"column:quantity;default:0;check:chk_stock_lots_quantity,quantity >= 0"`
+	UnitCost       float64   `json:"unit_cost" gorm:"column:unit_cost;default:0"` // weighted average purchase cost of the lot's base units
+	CreatedAt      time.Time `json:"created_at" gorm:"column:created_at"`
+
+	Medicine Medicine  `json:"-" gorm:"foreignKey:MedicineID;references:ID"`
+	Location *Location `json:"-" gorm:"foreignKey:LocationID;references:ID"`
+}
+
+func (s *StockLot) TableName() string {
+	return "stock_lots"
+}
+
+// StockUpdationLot records how much of a stock updation went into (or came out of) each lot,
+// at the unit cost it was bought at or, for deductions, the lot's cost when it was drawn.
+type StockUpdationLot struct {
+	StockUpdationID int     `json:"stock_updation_id" gorm:"column:stock_updation_id;primaryKey"`
+	StockLotID      int     `json:"stock_lot_id" gorm:"column:stock_lot_id;primaryKey"`
+	MedicineID      int     `json:"medicine_id" gorm:"column:medicine_id"`
+	Quantity        int     `json:"quantity" gorm:"column:quantity"`
+	UnitCost        float64 `json:"unit_cost" gorm:"column:unit_cost;default:0"`
+
+	StockLot      StockLot      `json:"-" gorm:"foreignKey:StockLotID;references:ID"`
+	StockUpdation StockUpdation `json:"-" gorm:"foreignKey:StockUpdationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (s *StockUpdationLot) TableName() string {
+	return "stock_updation_lots"
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"fmt"
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Movement kinds of stock updations. Sales and purchases are the normal flow,
+// every other kind needs a reason note.
+const (
+	MovementPurchase       = "purchase"
+	MovementOpeningBalance = "opening_balance"
+	MovementCustomerReturn = "customer_return"
+
+	MovementSale               = "sale"
+	MovementDamaged            = "damaged"
+	MovementExpiredWriteOff    = "expired_write_off"
+	MovementReturnedToSupplier = "returned_to_supplier"
+	MovementTheftLoss          = "theft_loss"
+
+	MovementStockTake = "stock_take"
+
+	MovementTransferIn  = "transfer_in"
+	MovementTransferOut = "transfer_out"
+)
+
+var (
+	ErrInvalidMovementKind = fmt.Errorf("Movement kind is not valid for this direction of stock updation")
+	ErrReasonRequired      = fmt.Errorf("A reason is required for this movement kind")
+)
+
+var additionKinds = map[string]bool{
+	MovementPurchase:       true,
+	MovementOpeningBalance: true,
+	MovementCustomerReturn: true,
+}
+
+var deductionKinds = map[string]bool{
+	MovementSale:               true,
+	MovementDamaged:            true,
+	MovementExpiredWriteOff:    true,
+	MovementReturnedToSupplier: true,
+	MovementTheftLoss:          true,
+}
+
+// lossKinds are deductions that are not sales, reported apart from sales.
+var lossKinds = map[string]bool{
+	MovementDamaged:         true,
+	MovementExpiredWriteOff: true,
+	MovementTheftLoss:       true,
+}
+
+// checkMovementKind defaults an empty kind to purchase or sale and checks that the kind
+// fits the direction and carries a reason when needed. Returns the kind to store.
+func checkMovementKind(kind, reason string, isAddition bool) (string, error) {
+	if kind == "" {
+		if isAddition {
+			return MovementPurchase, nil
+		}
+		return MovementSale, nil
+	}
+	if isAddition && !additionKinds[kind] || !isAddition && !deductionKinds[kind] {
+		return "", ErrInvalidMovementKind
+	}
+	if kind != MovementPurchase && kind != MovementSale && reason == "" {
+		return "", ErrReasonRequired
+	}
+	return kind, nil
+}
+
+// BackfillMovementKinds sets the kind of stock updations recorded before kinds existed.
+func BackfillMovementKinds(db *gorm.DB) error {
+	return db.Exec("UPDATE stock_updations SET kind = CASE WHEN is_addition THEN ? ELSE ? END WHERE kind IS NULL OR kind = ''", MovementPurchase, MovementSale).Error
+}
+
+// GetMovementSummary totals the quantity and value moved per kind between from and to (both optional,
+// to is inclusive). Reversals are netted off against the kind they reverse.
+func GetMovementSummary(db *gorm.DB, from, to *time.Time) (*response.MovementSummary, error) {
+	query := db.Table("stock_updation_particulars sup").
+		Select(`su.kind,
+			su.is_addition,
+			sup.medicine_id,
+			m.name AS medicine,
+			SUM(CASE WHEN su.entry_type = 'reversal' THEN -sup.quantity ELSE sup.quantity END) AS quantity,
+			SUM(CASE WHEN su.entry_type = 'reversal' THEN -sup.quantity ELSE sup.quantity END * sup.unit_price) AS value`).
+		Joins("JOIN stock_updations su ON sup.stock_updation_id = su.id").
+		Joins("JOIN medicines m ON sup.medicine_id = m.id")
+	if from != nil {
+		query = query.Where("su.brought_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("su.brought_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	var lines []response.MovementSummaryLine
+	err := query.Group("su.kind, su.is_addition, sup.medicine_id, m.name").Order("su.kind, m.name").Scan(&lines).Error
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &response.MovementSummary{
+		From:  from,
+		To:    to,
+		Kinds: []response.MovementKindSummary{},
+	}
+	for _, line := range lines {
+		if line.Quantity == 0 {
+			continue
+		}
+		if len(summary.Kinds) == 0 || summary.Kinds[len(summary.Kinds)-1].Kind != line.Kind || summary.Kinds[len(summary.Kinds)-1].IsAddtion != line.IsAddtion {
+			summary.Kinds = append(summary.Kinds, response.MovementKindSummary{
+				Kind:      line.Kind,
+				IsAddtion: line.IsAddtion,
+				IsLoss:    lossKinds[line.Kind],
+			})
+		}
+		kindSummary := &summary.Kinds[len(summary.Kinds)-1]
+		kindSummary.Medicines = append(kindSummary.Medicines, line)
+		kindSummary.Quantity += line.Quantity
+		kindSummary.Value += line.Value
+
+		switch {
+		case line.Kind == MovementSale:
+			summary.SalesValue += line.Value
+		case lossKinds[line.Kind]:
+			summary.LossValue += line.Value
+		}
+	}
+
+	return summary, nil
+}
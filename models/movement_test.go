@@ -0,0 +1,44 @@
+package models
+
+import "testing"
+
+func TestCheckMovementKind(t *testing.T) {
+	tests := []struct {
+		name       string
+		kind       string
+		reason     string
+		isAddition bool
+		want       string
+		wantErr    error
+	}{
+		{"addition defaults to purchase", "", "", true, MovementPurchase, nil},
+		{"deduction defaults to sale", "", "", false, MovementSale, nil},
+		{"purchase needs no reason", MovementPurchase, "", true, MovementPurchase, nil},
+		{"sale needs no reason", MovementSale, "", false, MovementSale, nil},
+		{"opening balance with reason", MovementOpeningBalance, "migrated", true, MovementOpeningBalance, nil},
+		{"customer return with reason", MovementCustomerReturn, "wrong strength", true, MovementCustomerReturn, nil},
+		{"customer return without reason", MovementCustomerReturn, "", true, "", ErrReasonRequired},
+		{"damaged with reason", MovementDamaged, "dropped", false, MovementDamaged, nil},
+		{"damaged without reason", MovementDamaged, "", false, "", ErrReasonRequired},
+		{"theft without reason", MovementTheftLoss, "", false, "", ErrReasonRequired},
+		{"expired write off with reason", MovementExpiredWriteOff, "expired", false, MovementExpiredWriteOff, nil},
+		{"returned to supplier with reason", MovementReturnedToSupplier, "recall", false, MovementReturnedToSupplier, nil},
+		{"sale as an addition", MovementSale, "", true, "", ErrInvalidMovementKind},
+		{"purchase as a deduction", MovementPurchase, "", false, "", ErrInvalidMovementKind},
+		{"damaged as an addition", MovementDamaged, "dropped", true, "", ErrInvalidMovementKind},
+		{"stock take is posted internally", MovementStockTake, "count", true, "", ErrInvalidMovementKind},
+		{"transfer out is posted internally", MovementTransferOut, "move", false, "", ErrInvalidMovementKind},
+		{"unknown kind", "gift", "free sample", false, "", ErrInvalidMovementKind},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkMovementKind(tt.kind, tt.reason, tt.isAddition)
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("kind = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
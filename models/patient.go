@@ -15,14 +15,38 @@ type Patient struct {
 	Description string         `json:"description" gorm:"column:description"`
 	CreatedAt   time.Time      `json:"created_at" gorm:"column:created_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// set when the patient was registered twice and this record was merged into the other
+	MergedIntoID *int       `json:"merged_into_id,omitempty" gorm:"column:merged_into_id"`
+	MergedAt     *time.Time `json:"merged_at,omitempty" gorm:"column:merged_at"`
+	MergedBy     string     `json:"merged_by,omitempty" gorm:"column:merged_by"`
+
+	OutstandingBalance float64 `json:"outstanding_balance" gorm:"-"` // owed on issued invoices, only filled in for a single patient
+	PossibleDuplicates []Patient `json:"possible_duplicates,omitempty" gorm:"-"` // likely the same person, only filled in on registration
 }
 
 func (p *Patient) Create(db *gorm.DB) error {
 	return db.Create(p).Error
 }
 
+// Update saves the patient's details. A deleted or merged patient is not found, and is never brought back by it.
 func (p *Patient) Update(db *gorm.DB) error {
-	return db.Save(p).Error
+	result := db.Model(&Patient{}).Where("id = ?", p.ID).
+		Select("name", "age", "gender", "contact", "description").
+		Updates(map[string]interface{}{
+			"name":        p.Name,
+			"age":         p.Age,
+			"gender":      p.Gender,
+			"contact":     p.Contact,
+			"description": p.Description,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return db.First(p, p.ID).Error
 }
 
 func GetPatientByID(db *gorm.DB, id int) (*Patient, error) {
@@ -34,17 +58,19 @@ func GetPatientByID(db *gorm.DB, id int) (*Patient, error) {
 	return &patient, nil
 }
 
-func GetAllPatients(db *gorm.DB, offset, limit int) ([]Patient, error) {
-	var patients []Patient
-	err := db.Raw("SELECT * FROM patients WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT ? OFFSET ?", limit, offset).Scan(&patients).Error
-	return patients, err
-}
-
 func DeletePatient(db *gorm.DB, id int) error {
 	return db.Delete(&Patient{}, id).Error
 }
 
 func UndoDeletePatient(db *gorm.DB, id int) error {
+	var patient Patient
+	err := db.Unscoped().Select("merged_into_id").First(&patient, id).Error
+	if err != nil {
+		return err
+	}
+	if patient.MergedIntoID != nil {
+		return ErrPatientMerged
+	}
 	return db.Model(&Patient{}).Where("id = ?", id).Update("deleted_at", nil).Error
 }
 
@@ -54,20 +80,61 @@ type Visit struct {
 	Date      time.Time `json:"date" gorm:"column:date"`
 	Notes     string    `json:"notes" gorm:"column:notes"`
 
+	ChiefComplaint string `json:"chief_complaint" gorm:"column:chief_complaint"`
+	Examination    string `json:"examination" gorm:"column:examination"` // examination findings
+
+	// vitals, nil when not taken
+	BPSystolic  *int     `json:"bp_systolic" gorm:"column:bp_systolic"`   // mmHg
+	BPDiastolic *int     `json:"bp_diastolic" gorm:"column:bp_diastolic"` // mmHg
+	Pulse       *int     `json:"pulse" gorm:"column:pulse"`               // beats per minute
+	Temperature *float64 `json:"temperature" gorm:"column:temperature"`   // degrees Celsius
+	Weight      *float64 `json:"weight" gorm:"column:weight"`             // kg
+	SpO2        *int     `json:"spo2" gorm:"column:spo2"`                 // percent
+
+	Diagnoses []VisitDiagnosis `json:"diagnoses" gorm:"foreignKey:VisitID"`
+
 	Patient Patient `json:"-" gorm:"foreignKey:PatientID;references:ID"`
 }
 
 func (v *Visit) Create(db *gorm.DB) error {
-	return db.Create(v).Error
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	err := tx.Omit("Diagnoses").Create(v).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = saveVisitDiagnoses(tx, v)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
 func (v *Visit) Update(db *gorm.DB) error {
-	return db.Save(v).Error
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	err := tx.Omit("Diagnoses").Save(v).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = saveVisitDiagnoses(tx, v)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
 func GetVisitByID(db *gorm.DB, id int) (*Visit, error) {
 	var visit Visit
-	err := db.First(&visit, id).Error
+	err := db.Preload("Diagnoses").First(&visit, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +143,7 @@ func GetVisitByID(db *gorm.DB, id int) (*Visit, error) {
 
 func GetAllVisits(db *gorm.DB,offset,limit int) ([]Visit, error) {
 	var visits []Visit
-	err := db.Raw("SELECT * FROM visits ORDER BY date DESC LIMIT ? OFFSET ?", limit, offset).Scan(&visits).Error
+	err := db.Preload("Diagnoses").Order("date DESC").Limit(limit).Offset(offset).Find(&visits).Error
 	return visits, err
 }
 
@@ -86,6 +153,6 @@ func DeleteVisit(db *gorm.DB, id int) error {
 
 func GetAllVisitsByPatientID(db *gorm.DB, patientID int) ([]Visit, error) {
 	var visits []Visit
-	err := db.Where("patient_id = ?", patientID).Find(&visits).Error
+	err := db.Preload("Diagnoses").Where("patient_id = ?", patientID).Order("date DESC").Find(&visits).Error
 	return visits, err
 }
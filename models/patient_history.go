@@ -0,0 +1,176 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	HistoryVisit   = "visit"
+	HistoryInvoice = "invoice"
+	HistoryPayment = "payment"
+)
+
+// PatientHistory is a patient's visits, invoices and payments in the order they happened.
+type PatientHistory struct {
+	Patient Patient              `json:"patient"`
+	From    *time.Time           `json:"from"`
+	To      *time.Time           `json:"to"`
+	Events  []PatientHistoryItem `json:"events"`
+}
+
+// PatientHistoryItem is one event of the timeline, holding the visit, invoice or payment its type names.
+type PatientHistoryItem struct {
+	Date    time.Time     `json:"date"`
+	Type    string        `json:"type"`
+	Visit   *VisitHistory `json:"visit,omitempty"`
+	Invoice *Invoice      `json:"invoice,omitempty"`
+	Payment *Payment      `json:"payment,omitempty"`
+}
+
+// VisitHistory is a visit with what was prescribed in it and what was dispensed against that.
+type VisitHistory struct {
+	Visit
+	Prescriptions []Prescription      `json:"prescriptions"`
+	Dispensed     []DispensedMedicine `json:"dispensed"`
+}
+
+// DispensedMedicine is a medicine given out for a visit, from the sale deduction that dispensed it.
+type DispensedMedicine struct {
+	StockUpdationID int       `json:"stock_updation_id" gorm:"column:stock_updation_id"`
+	DispensedAt     time.Time `json:"dispensed_at" gorm:"column:dispensed_at"`
+	MedicineID      int       `json:"medicine_id" gorm:"column:medicine_id"`
+	Medicine        string    `json:"medicine" gorm:"column:medicine"`
+	Quantity        int       `json:"quantity" gorm:"column:quantity"`
+	UnitPrice       float64   `json:"unit_price" gorm:"column:unit_price"`
+}
+
+// GetPatientHistory puts together the patient's timeline between the dates, both inclusive and either
+// open when nil. Invoices are dated when they were issued, drafts when they were made.
+func GetPatientHistory(db *gorm.DB, patientID int, from, to *time.Time) (*PatientHistory, error) {
+	patient, err := GetPatientByID(db, patientID)
+	if err != nil {
+		return nil, err
+	}
+	history := &PatientHistory{
+		Patient: *patient,
+		From:    from,
+		To:      to,
+		Events:  []PatientHistoryItem{},
+	}
+
+	inRange := func(query *gorm.DB, column string) *gorm.DB {
+		if from != nil {
+			query = query.Where(column+" >= ?", *from)
+		}
+		if to != nil {
+			query = query.Where(column+" < ?", to.AddDate(0, 0, 1))
+		}
+		return query
+	}
+
+	var visits []Visit
+	err = inRange(db.Preload("Diagnoses").Where("patient_id = ?", patientID), "date").Find(&visits).Error
+	if err != nil {
+		return nil, err
+	}
+	visitIDs := make([]int, len(visits))
+	for i := range visits {
+		visitIDs[i] = visits[i].ID
+	}
+
+	var prescriptions []Prescription
+	err = db.Where("visit_id IN ?", visitIDs).Order("id").Find(&prescriptions).Error
+	if err != nil {
+		return nil, err
+	}
+	prescriptionsByVisit := make(map[int][]Prescription)
+	for _, prescription := range prescriptions {
+		prescriptionsByVisit[prescription.VisitID] = append(prescriptionsByVisit[prescription.VisitID], prescription)
+	}
+
+	var dispensed []struct {
+		VisitID int `gorm:"column:visit_id"`
+		DispensedMedicine
+	}
+	query := `
+		SELECT
+			su.visit_id,
+			su.id AS stock_updation_id,
+			su.brought_at AS dispensed_at,
+			sup.medicine_id,
+			m.name AS medicine,
+			sup.quantity,
+			sup.unit_price
+		FROM
+			stock_updations su
+		JOIN
+			stock_updation_particulars sup
+		ON
+			sup.stock_updation_id = su.id
+		JOIN
+			medicines m
+		ON
+			sup.medicine_id = m.id
+		WHERE
+			su.visit_id IN ?
+			AND NOT su.is_addition
+			AND su.entry_type <> ?
+			AND su.voided_at IS NULL
+		ORDER BY
+			su.brought_at, m.name
+	`
+	err = db.Raw(query, visitIDs, EntryTypeReversal).Scan(&dispensed).Error
+	if err != nil {
+		return nil, err
+	}
+	dispensedByVisit := make(map[int][]DispensedMedicine)
+	for _, medicine := range dispensed {
+		dispensedByVisit[medicine.VisitID] = append(dispensedByVisit[medicine.VisitID], medicine.DispensedMedicine)
+	}
+
+	for i := range visits {
+		visit := &VisitHistory{
+			Visit:         visits[i],
+			Prescriptions: prescriptionsByVisit[visits[i].ID],
+			Dispensed:     dispensedByVisit[visits[i].ID],
+		}
+		if visit.Prescriptions == nil {
+			visit.Prescriptions = []Prescription{}
+		}
+		if visit.Dispensed == nil {
+			visit.Dispensed = []DispensedMedicine{}
+		}
+		history.Events = append(history.Events, PatientHistoryItem{Date: visits[i].Date, Type: HistoryVisit, Visit: visit})
+	}
+
+	var invoices []Invoice
+	err = inRange(db.Preload("Lines").Where("patient_id = ?", patientID), "COALESCE(issued_at, created_at)").Find(&invoices).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range invoices {
+		date := invoices[i].CreatedAt
+		if invoices[i].IssuedAt != nil {
+			date = *invoices[i].IssuedAt
+		}
+		history.Events = append(history.Events, PatientHistoryItem{Date: date, Type: HistoryInvoice, Invoice: &invoices[i]})
+	}
+
+	var payments []Payment
+	err = inRange(db.Where("patient_id = ?", patientID), "received_at").Find(&payments).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range payments {
+		history.Events = append(history.Events, PatientHistoryItem{Date: payments[i].ReceivedAt, Type: HistoryPayment, Payment: &payments[i]})
+	}
+
+	sort.SliceStable(history.Events, func(i, j int) bool {
+		return history.Events[i].Date.Before(history.Events[j].Date)
+	})
+
+	return history, nil
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// duplicateNameSimilarity is how close, as a pg_trgm similarity, two names must be for the patients to be likely duplicates.
+const duplicateNameSimilarity = 0.4
+
+var (
+	ErrSelfMerge     = fmt.Errorf("A patient cannot be merged into itself")
+	ErrPatientMerged = fmt.Errorf("Patient was merged into another patient and cannot be restored")
+)
+
+// FindDuplicatePatients lists the other patients likely to be the same person as p, those with a similar
+// name and either the same contact number or an age a year apart at most. The closest names come first.
+func FindDuplicatePatients(db *gorm.DB, p *Patient) ([]Patient, error) {
+	duplicates := []Patient{}
+	name := p.Name
+	err := db.Model(&Patient{}).
+		Where("id <> ?", p.ID).
+		Where("similarity(LOWER(name), LOWER(?)) >= ?", name, duplicateNameSimilarity).
+		Where(`(regexp_replace(?, '\D', '', 'g') <> '' AND regexp_replace(contact, '\D', '', 'g') = regexp_replace(?, '\D', '', 'g'))
+			OR (? > 0 AND age > 0 AND ABS(age - ?) <= 1)`, p.Contact, p.Contact, p.Age, p.Age).
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: "similarity(LOWER(name), LOWER(?)) DESC, id", Vars: []interface{}{name}, WithoutParentheses: true}}).
+		Limit(10).
+		Find(&duplicates).Error
+	return duplicates, err
+}
+
+// MergePatients moves the visits, and with them their prescriptions, the invoices and the payments of the
+// merged patient to the surviving one in a single transaction. The merged patient is soft deleted pointing
+// to the survivor, and the survivor's missing contact, age and gender are taken from it.
+func MergePatients(db *gorm.DB, mergedID, survivorID int, mergedBy string) (*Patient, error) {
+	if mergedID == survivorID {
+		return nil, ErrSelfMerge
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	// locked in id order so that two merges of the same pair cannot deadlock
+	var patients []Patient
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", []int{mergedID, survivorID}).Order("id").Find(&patients).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if len(patients) != 2 {
+		tx.Rollback()
+		return nil, gorm.ErrRecordNotFound
+	}
+	merged, survivor := &patients[0], &patients[1]
+	if merged.ID != mergedID {
+		merged, survivor = survivor, merged
+	}
+
+	for _, table := range []string{"visits", "invoices", "payments"} {
+		err = tx.Exec("UPDATE "+table+" SET patient_id = ? WHERE patient_id = ?", survivorID, mergedID).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	updates := map[string]interface{}{}
+	if survivor.Contact == "" && merged.Contact != "" {
+		updates["contact"] = merged.Contact
+	}
+	if survivor.Age == 0 && merged.Age != 0 {
+		updates["age"] = merged.Age
+	}
+	if survivor.Gender == "" && merged.Gender != "" {
+		updates["gender"] = merged.Gender
+	}
+	if len(updates) > 0 {
+		err = tx.Model(survivor).Updates(updates).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	err = tx.Model(merged).Updates(map[string]interface{}{
+		"merged_into_id": survivorID,
+		"merged_at":      now,
+		"merged_by":      mergedBy,
+		"deleted_at":     now,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.First(survivor, survivorID).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return survivor, tx.Commit().Error
+}
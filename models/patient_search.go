@@ -0,0 +1,68 @@
+package models
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PatientSearch filters the patient list. Query matches the start of any word of the name or the start
+// of the contact, and also names and contacts spelt close to it. Nil ages and an empty gender do not filter.
+type PatientSearch struct {
+	Query  string
+	MinAge *int
+	MaxAge *int
+	Gender string
+}
+
+// CreatePatientSearchIndexes enables pg_trgm and adds the trigram indexes the patient search uses.
+func CreatePatientSearchIndexes(db *gorm.DB) error {
+	err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error
+	if err != nil {
+		return err
+	}
+	err = db.Exec("CREATE INDEX IF NOT EXISTS idx_patients_name_trgm ON patients USING gin (LOWER(name) gin_trgm_ops)").Error
+	if err != nil {
+		return err
+	}
+	return db.Exec("CREATE INDEX IF NOT EXISTS idx_patients_contact_trgm ON patients USING gin (contact gin_trgm_ops)").Error
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// SearchPatients lists the patients matching the search. With a query the prefix matches come first,
+// then the rest by how similar they are, otherwise the newest patients come first.
+func SearchPatients(db *gorm.DB, search *PatientSearch, offset, limit int) ([]Patient, error) {
+	patients := []Patient{}
+	query := db.Model(&Patient{})
+
+	if q := strings.ToLower(strings.TrimSpace(search.Query)); q != "" {
+		wordPrefix := "% " + escapeLike(q) + "%"
+		prefix := escapeLike(q) + "%"
+		query = query.
+			Where("(' ' || LOWER(name)) LIKE ? OR contact LIKE ? OR LOWER(name) % ? OR ? <% LOWER(name) OR contact % ?",
+				wordPrefix, prefix, q, q, q).
+			Order(clause.OrderBy{Expression: clause.Expr{
+				SQL: `((' ' || LOWER(name)) LIKE ? OR contact LIKE ?) DESC,
+					GREATEST(similarity(LOWER(name), ?), word_similarity(?, LOWER(name)), similarity(contact, ?)) DESC`,
+				Vars:               []interface{}{wordPrefix, prefix, q, q, q},
+				WithoutParentheses: true,
+			}})
+	}
+	if search.MinAge != nil {
+		query = query.Where("age >= ?", *search.MinAge)
+	}
+	if search.MaxAge != nil {
+		query = query.Where("age <= ?", *search.MaxAge)
+	}
+	if search.Gender != "" {
+		query = query.Where("LOWER(gender) = LOWER(?)", search.Gender)
+	}
+
+	err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&patients).Error
+	return patients, err
+}
@@ -0,0 +1,324 @@
+package models
+
+import (
+	"fmt"
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PaymentCash = "cash"
+	PaymentCard = "card"
+	PaymentUPI  = "upi"
+)
+
+// Payment statuses of an issued invoice. An invoice not fully paid is sold on credit,
+// and what is left of it is owed by the patient.
+const (
+	InvoiceUnpaid        = "unpaid"
+	InvoicePartiallyPaid = "partially_paid"
+	InvoicePaid          = "paid"
+)
+
+var (
+	ErrInvoiceNotIssued   = fmt.Errorf("Payments can only be taken against issued invoices")
+	ErrOverpayment        = fmt.Errorf("Payment is more than the amount outstanding")
+	ErrNothingOutstanding = fmt.Errorf("Nothing is outstanding")
+	ErrPaymentVoided      = fmt.Errorf("Payment is already voided")
+	ErrInvoicePaid        = fmt.Errorf("Invoice has payments, void them before cancelling it")
+)
+
+// Payment is money received against an invoice. A voided payment, like a refund or a bounced
+// card payment, stays on record but no longer counts towards the invoice.
+type Payment struct {
+	ID         int        `json:"id" gorm:"column:id;primaryKey"`
+	InvoiceID  int        `json:"invoice_id" gorm:"column:invoice_id;index"`
+	PatientID  *int       `json:"patient_id" gorm:"column:patient_id;index"`
+	Amount     float64    `json:"amount" gorm:"column:amount;check:chk_payments_amount,amount > 0"`
+	Method     string     `json:"method" gorm:"column:method"`
+	Reference  string     `json:"reference" gorm:"column:reference"` // card or UPI transaction reference
+	ReceivedAt time.Time  `json:"received_at" gorm:"column:received_at"`
+	ReceivedBy string     `json:"received_by" gorm:"column:received_by"`
+	Notes      string     `json:"notes" gorm:"column:notes"`
+	VoidedAt   *time.Time `json:"voided_at" gorm:"column:voided_at"`
+	VoidedBy   string     `json:"voided_by" gorm:"column:voided_by"`
+	VoidReason string     `json:"void_reason" gorm:"column:void_reason"`
+
+	Invoice Invoice  `json:"-" gorm:"foreignKey:InvoiceID;references:ID"`
+	Patient *Patient `json:"-" gorm:"foreignKey:PatientID;references:ID"`
+}
+
+// refreshInvoicePayment sets the amount paid and the payment status of the invoice from its payments.
+func refreshInvoicePayment(tx *gorm.DB, invoice *Invoice) error {
+	var paid float64
+	err := tx.Raw("SELECT COALESCE(SUM(amount), 0) FROM payments WHERE invoice_id = ? AND voided_at IS NULL", invoice.ID).Scan(&paid).Error
+	if err != nil {
+		return err
+	}
+
+	invoice.AmountPaid = roundAmount(paid)
+	switch {
+	case invoice.AmountPaid >= invoice.Total:
+		invoice.PaymentStatus = InvoicePaid
+	case invoice.AmountPaid > 0:
+		invoice.PaymentStatus = InvoicePartiallyPaid
+	default:
+		invoice.PaymentStatus = InvoiceUnpaid
+	}
+	return tx.Model(&Invoice{}).Where("id = ?", invoice.ID).Updates(map[string]interface{}{
+		"amount_paid":    invoice.AmountPaid,
+		"payment_status": invoice.PaymentStatus,
+	}).Error
+}
+
+// payInvoice records the payment against the locked invoice, which must be issued and owe at least the amount.
+func payInvoice(tx *gorm.DB, invoice *Invoice, payment *Payment) error {
+	if invoice.Status != InvoiceIssued {
+		return ErrInvoiceNotIssued
+	}
+	if roundAmount(payment.Amount) > roundAmount(invoice.Total-invoice.AmountPaid) {
+		return ErrOverpayment
+	}
+
+	payment.ID = 0
+	payment.InvoiceID = invoice.ID
+	payment.PatientID = invoice.PatientID
+	if payment.ReceivedAt.IsZero() {
+		payment.ReceivedAt = time.Now()
+	}
+	err := tx.Create(payment).Error
+	if err != nil {
+		return err
+	}
+
+	return refreshInvoicePayment(tx, invoice)
+}
+
+// RecordInvoicePayment takes a full or part payment against an issued invoice.
+func RecordInvoicePayment(db *gorm.DB, invoiceID int, payment *Payment) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	var invoice Invoice
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invoice, invoiceID).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = payInvoice(tx, &invoice, payment)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// RecordPatientPayment settles the patient's dues with one payment, oldest invoice first.
+// The payment is split into one payment per invoice it goes to, which are returned.
+func RecordPatientPayment(db *gorm.DB, patientID int, payment *Payment) ([]Payment, error) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	if _, err := GetPatientByID(tx, patientID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var invoices []Invoice
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("patient_id = ? AND status = ? AND payment_status <> ?", patientID, InvoiceIssued, InvoicePaid).
+		Order("issued_at, id").Find(&invoices).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if len(invoices) == 0 {
+		tx.Rollback()
+		return nil, ErrNothingOutstanding
+	}
+
+	payments := []Payment{}
+	remaining := roundAmount(payment.Amount)
+	for i := range invoices {
+		if remaining <= 0 {
+			break
+		}
+		part := *payment
+		part.Amount = min(remaining, roundAmount(invoices[i].Total-invoices[i].AmountPaid))
+		err = payInvoice(tx, &invoices[i], &part)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		remaining = roundAmount(remaining - part.Amount)
+		payments = append(payments, part)
+	}
+	if remaining > 0 {
+		tx.Rollback()
+		return nil, ErrOverpayment
+	}
+
+	return payments, tx.Commit().Error
+}
+
+// VoidPayment voids a payment, like a refund, putting its amount back on the invoice's balance.
+func VoidPayment(db *gorm.DB, id int, reason, voidedBy string) (*Payment, error) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	var payment Payment
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, id).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if payment.VoidedAt != nil {
+		tx.Rollback()
+		return nil, ErrPaymentVoided
+	}
+
+	var invoice Invoice
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invoice, payment.InvoiceID).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	now := time.Now()
+	payment.VoidedAt = &now
+	payment.VoidedBy = voidedBy
+	payment.VoidReason = reason
+	err = tx.Model(&payment).Updates(map[string]interface{}{
+		"voided_at":   now,
+		"voided_by":   voidedBy,
+		"void_reason": reason,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = refreshInvoicePayment(tx, &invoice)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return &payment, tx.Commit().Error
+}
+
+func GetInvoicePayments(db *gorm.DB, invoiceID int) ([]Payment, error) {
+	payments := []Payment{}
+	err := db.Where("invoice_id = ?", invoiceID).Order("received_at, id").Find(&payments).Error
+	return payments, err
+}
+
+// GetPatientOutstanding is what the patient owes on issued invoices.
+func GetPatientOutstanding(db *gorm.DB, patientID int) (float64, error) {
+	var outstanding float64
+	err := db.Raw("SELECT COALESCE(SUM(total - amount_paid), 0) FROM invoices WHERE patient_id = ? AND status = ?", patientID, InvoiceIssued).Scan(&outstanding).Error
+	return roundAmount(outstanding), err
+}
+
+// GetPatientLedger lists what the patient was billed and paid in order, with the running balance owed.
+// Issued invoices are debits and payments credits; cancelled invoices and voided payments are undone
+// on the date they were cancelled or voided.
+func GetPatientLedger(db *gorm.DB, patientID int) (*response.PatientLedger, error) {
+	ledger := &response.PatientLedger{
+		PatientID: patientID,
+		Entries:   []response.PatientLedgerEntry{},
+	}
+	query := `
+		SELECT * FROM (
+			SELECT issued_at AS date, 'invoice' AS type, id AS invoice_id, invoice_no, NULL AS payment_id, '' AS method, total AS debit, 0 AS credit
+			FROM invoices WHERE patient_id = ? AND issued_at IS NOT NULL
+			UNION ALL
+			SELECT cancelled_at, 'invoice_cancelled', id, invoice_no, NULL, '', 0, total
+			FROM invoices WHERE patient_id = ? AND issued_at IS NOT NULL AND cancelled_at IS NOT NULL
+			UNION ALL
+			SELECT p.received_at, 'payment', i.id, i.invoice_no, p.id, p.method, 0, p.amount
+			FROM payments p JOIN invoices i ON p.invoice_id = i.id WHERE p.patient_id = ?
+			UNION ALL
+			SELECT p.voided_at, 'payment_voided', i.id, i.invoice_no, p.id, p.method, p.amount, 0
+			FROM payments p JOIN invoices i ON p.invoice_id = i.id WHERE p.patient_id = ? AND p.voided_at IS NOT NULL
+		) entries
+		ORDER BY
+			date, type
+	`
+	err := db.Raw(query, patientID, patientID, patientID, patientID).Scan(&ledger.Entries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	balance := 0.0
+	for i := range ledger.Entries {
+		balance = roundAmount(balance + ledger.Entries[i].Debit - ledger.Entries[i].Credit)
+		ledger.Entries[i].Balance = balance
+	}
+	ledger.Balance = balance
+	return ledger, nil
+}
+
+// GetDuesAgeing buckets what every patient owes by how long ago the invoices were issued.
+func GetDuesAgeing(db *gorm.DB) (*response.DuesAgeing, error) {
+	now := time.Now()
+	ageing := &response.DuesAgeing{
+		GeneratedAt: now,
+		Patients:    []response.PatientDues{},
+	}
+	query := `
+		SELECT
+			p.id AS patient_id,
+			p.name AS patient,
+			p.contact,
+			COALESCE(SUM(i.total - i.amount_paid) FILTER (WHERE i.issued_at > ?), 0) AS current,
+			COALESCE(SUM(i.total - i.amount_paid) FILTER (WHERE i.issued_at <= ? AND i.issued_at > ?), 0) AS days31_to60,
+			COALESCE(SUM(i.total - i.amount_paid) FILTER (WHERE i.issued_at <= ? AND i.issued_at > ?), 0) AS days61_to90,
+			COALESCE(SUM(i.total - i.amount_paid) FILTER (WHERE i.issued_at <= ?), 0) AS over90,
+			SUM(i.total - i.amount_paid) AS total,
+			MIN(i.issued_at) AS oldest_due_at
+		FROM
+			invoices i
+		JOIN
+			patients p
+		ON
+			i.patient_id = p.id
+		WHERE
+			i.status = ?
+			AND i.payment_status <> ?
+		GROUP BY
+			p.id, p.name, p.contact
+		ORDER BY
+			total DESC
+	`
+	days30, days60, days90 := now.AddDate(0, 0, -30), now.AddDate(0, 0, -60), now.AddDate(0, 0, -90)
+	err := db.Raw(query, days30, days30, days60, days60, days90, days90, InvoiceIssued, InvoicePaid).Scan(&ageing.Patients).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dues := range ageing.Patients {
+		ageing.Current += dues.Current
+		ageing.Days31To60 += dues.Days31To60
+		ageing.Days61To90 += dues.Days61To90
+		ageing.Over90 += dues.Over90
+		ageing.Total += dues.Total
+	}
+	ageing.Current = roundAmount(ageing.Current)
+	ageing.Days31To60 = roundAmount(ageing.Days31To60)
+	ageing.Days61To90 = roundAmount(ageing.Days61To90)
+	ageing.Over90 = roundAmount(ageing.Over90)
+	ageing.Total = roundAmount(ageing.Total)
+	return ageing, nil
+}
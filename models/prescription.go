@@ -0,0 +1,240 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrAlreadyDispensed  = fmt.Errorf("Prescription of this visit is already dispensed")
+	ErrNothingToDispense = fmt.Errorf("Prescription has no quantity to dispense")
+)
+
+// Prescription is a medicine prescribed in a visit. Quantity is what is dispensed from stock for it.
+type Prescription struct {
+	ID           int    `json:"id" gorm:"column:id;primaryKey"`
+	VisitID      int    `json:"visit_id" gorm:"column:visit_id;index"`
+	MedicineID   int    `json:"medicine_id" gorm:"column:medicine_id"`
+	Dose         string `json:"dose" gorm:"column:dose"`
+	Frequency    string `json:"frequency" gorm:"column:frequency"`
+	DurationDays int    `json:"duration_days" gorm:"column:duration_days"`
+	Quantity     int    `json:"quantity" gorm:"column:quantity"`
+	Instructions string `json:"instructions" gorm:"column:instructions"`
+
+	Visit    Visit    `json:"-" gorm:"foreignKey:VisitID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Medicine Medicine `json:"-" gorm:"foreignKey:MedicineID;references:ID"`
+}
+
+func (p *Prescription) TableName() string {
+	return "prescriptions"
+}
+
+func GetPrescriptionsByVisitID(db *gorm.DB, visitID int) ([]Prescription, error) {
+	var prescriptions []Prescription
+	err := db.Where("visit_id = ?", visitID).Order("id").Find(&prescriptions).Error
+	return prescriptions, err
+}
+
+// getVisitDeductionID returns the id of the stock deduction that dispensed the prescription of a visit, or 0.
+func getVisitDeductionID(tx *gorm.DB, visitID int) (int, error) {
+	var stockUpdation StockUpdation
+	err := tx.Where("visit_id = ? AND is_addition = ? AND entry_type <> ? AND voided_at IS NULL", visitID, false, EntryTypeReversal).First(&stockUpdation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return stockUpdation.ID, nil
+}
+
+func prescriptionStockChanges(prescriptions []Prescription) []StockChanges {
+	stockChanges := []StockChanges{}
+	for i := range prescriptions {
+		if prescriptions[i].Quantity > 0 {
+			stockChanges = append(stockChanges, StockChanges{
+				MedicineID: prescriptions[i].MedicineID,
+				Quantity:   prescriptions[i].Quantity,
+			})
+		}
+	}
+	return stockChanges
+}
+
+// ReplaceVisitPrescriptions replaces the prescription of a visit. If it was already dispensed,
+// the linked stock deduction is adjusted to the new quantities in the same transaction.
+func ReplaceVisitPrescriptions(db *gorm.DB, visitID int, prescriptions []Prescription, allowExpired bool) (error, int) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error, 0
+	}
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&Visit{}, visitID).Error
+	if err != nil {
+		tx.Rollback()
+		return err, 0
+	}
+
+	err = tx.Delete(&Prescription{}, "visit_id = ?", visitID).Error
+	if err != nil {
+		tx.Rollback()
+		return err, 0
+	}
+
+	for i := range prescriptions {
+		prescriptions[i].ID = 0
+		prescriptions[i].VisitID = visitID
+	}
+	if len(prescriptions) > 0 {
+		err = tx.Create(&prescriptions).Error
+		if err != nil {
+			tx.Rollback()
+			return err, 0
+		}
+	}
+
+	stockUpdationID, err := getVisitDeductionID(tx, visitID)
+	if err != nil {
+		tx.Rollback()
+		return err, 0
+	}
+
+	if stockUpdationID != 0 {
+		stockChanges := []StockAdditionChanges{}
+		for _, stockChange := range prescriptionStockChanges(prescriptions) {
+			stockChanges = append(stockChanges, StockAdditionChanges{StockChanges: stockChange})
+		}
+		if len(stockChanges) == 0 {
+			_, err = voidStockUpdation(tx, stockUpdationID, "prescription edited", "")
+		} else {
+			var insufficientMedID int
+			_, err, insufficientMedID = correctStockUpdation(tx, stockUpdationID, stockChanges, allowExpired, "prescription edited", "")
+			if err != nil {
+				tx.Rollback()
+				return err, insufficientMedID
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			return err, 0
+		}
+	}
+
+	return tx.Commit().Error, 0
+}
+
+// DispenseVisitPrescriptions deducts the prescribed quantities from stock at the location
+// (the default location when 0) as a deduction linked to the visit.
+func DispenseVisitPrescriptions(db *gorm.DB, visitID, locationID int, allowExpired bool) (*response.StockDeductionResponse, error, int) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error, 0
+	}
+
+	deduction, err, insufficientMedID := dispenseVisitPrescriptions(tx, visitID, locationID, allowExpired)
+	if err != nil {
+		tx.Rollback()
+		return nil, err, insufficientMedID
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err, 0
+	}
+	return deduction, nil, 0
+}
+
+// dispenseVisitPrescriptions is DispenseVisitPrescriptions inside the caller's transaction.
+func dispenseVisitPrescriptions(tx *gorm.DB, visitID, locationID int, allowExpired bool) (*response.StockDeductionResponse, error, int) {
+	// lock the visit so that two dispense requests for it cannot both pass the already-dispensed check
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&Visit{}, visitID).Error
+	if err != nil {
+		return nil, err, 0
+	}
+
+	stockUpdationID, err := getVisitDeductionID(tx, visitID)
+	if err != nil {
+		return nil, err, 0
+	}
+	if stockUpdationID != 0 {
+		return nil, ErrAlreadyDispensed, 0
+	}
+
+	var prescriptions []Prescription
+	err = tx.Where("visit_id = ?", visitID).Find(&prescriptions).Error
+	if err != nil {
+		return nil, err, 0
+	}
+	stockChanges := prescriptionStockChanges(prescriptions)
+	if len(stockChanges) == 0 {
+		return nil, ErrNothingToDispense, 0
+	}
+
+	locationID, err = resolveLocationID(tx, locationID)
+	if err != nil {
+		return nil, err, 0
+	}
+
+	stockUpdation := &StockUpdation{
+		BroughtAt:  time.Now(),
+		IsAddtion:  false,
+		Kind:       MovementSale,
+		LocationID: locationID,
+		VisitID:    &visitID,
+	}
+	err = tx.Create(stockUpdation).Error
+	if err != nil {
+		return nil, err, 0
+	}
+
+	allocations, err, insufficientMedID := deductStockParticulars(tx, stockUpdation.ID, locationID, stockChanges, allowExpired)
+	if err != nil {
+		return nil, err, insufficientMedID
+	}
+
+	return &response.StockDeductionResponse{
+		StockUpdationID: stockUpdation.ID,
+		Allocations:     allocations,
+	}, nil, 0
+}
+
+// CancelVisitPrescriptions removes the prescription of a visit and reverses its stock deduction, if dispensed.
+func CancelVisitPrescriptions(db *gorm.DB, visitID int) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	// lock the visit so that a dispense cannot post a deduction after the one to void was looked up
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&Visit{}, visitID).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	stockUpdationID, err := getVisitDeductionID(tx, visitID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if stockUpdationID != 0 {
+		_, err = voidStockUpdation(tx, stockUpdationID, "prescription cancelled", "")
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = tx.Delete(&Prescription{}, "visit_id = ?", visitID).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
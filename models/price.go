@@ -0,0 +1,161 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPriceAboveMRP = fmt.Errorf("Selling price cannot be more than the MRP")
+	ErrFuturePrice   = fmt.Errorf("Price cannot take effect in the future")
+)
+
+// MedicinePrice is a set of prices of a medicine in force from EffectiveFrom until the next one.
+// The latest one is also kept on the medicine itself. Prices are per base unit.
+type MedicinePrice struct {
+	ID            int       `json:"id" gorm:"column:id;primaryKey"`
+	MedicineID    int       `json:"medicine_id" gorm:"column:medicine_id;index:idx_medicine_prices_medicine_effective"`
+	CostPrice     float64   `json:"cost_price" gorm:"column:cost_price"`
+	MRP           float64   `json:"mrp" gorm:"column:mrp"`
+	SellingPrice  float64   `json:"selling_price" gorm:"column:selling_price"`
+	EffectiveFrom time.Time `json:"effective_from" gorm:"column:effective_from;index:idx_medicine_prices_medicine_effective"`
+	CreatedAt     time.Time `json:"created_at" gorm:"column:created_at"`
+
+	Medicine Medicine `json:"-" gorm:"foreignKey:MedicineID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+func (p *MedicinePrice) TableName() string {
+	return "medicine_prices"
+}
+
+func checkPrices(sellingPrice, mrp float64) error {
+	if mrp > 0 && sellingPrice > mrp {
+		return ErrPriceAboveMRP
+	}
+	return nil
+}
+
+// recordPrice adds the prices to the medicine's history and, when they are now the latest, to the medicine.
+func recordPrice(tx *gorm.DB, price *MedicinePrice) error {
+	if err := checkPrices(price.SellingPrice, price.MRP); err != nil {
+		return err
+	}
+	now := time.Now()
+	if price.EffectiveFrom.IsZero() {
+		price.EffectiveFrom = now
+	}
+	if price.EffectiveFrom.After(now) {
+		return ErrFuturePrice
+	}
+
+	price.ID = 0
+	err := tx.Create(price).Error
+	if err != nil {
+		return err
+	}
+
+	var latest MedicinePrice
+	err = tx.Where("medicine_id = ?", price.MedicineID).Order("effective_from DESC, id DESC").First(&latest).Error
+	if err != nil {
+		return err
+	}
+	if latest.ID != price.ID {
+		return nil
+	}
+	return tx.Model(&Medicine{}).Where("id = ?", price.MedicineID).Updates(map[string]interface{}{
+		"cost_price": price.CostPrice,
+		"mrp":        price.MRP,
+		"price":      price.SellingPrice,
+	}).Error
+}
+
+// AddMedicinePrice records a price change of the medicine, effective now unless backdated.
+// Bills and stock movements already made keep the prices they were made at.
+func AddMedicinePrice(db *gorm.DB, price *MedicinePrice) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	err := lockMedicines(tx, []int{price.MedicineID})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = GetMedicineByID(tx, price.MedicineID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPrice(tx, price)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func GetMedicinePriceHistory(db *gorm.DB, medicineID int) ([]MedicinePrice, error) {
+	prices := []MedicinePrice{}
+	err := db.Where("medicine_id = ?", medicineID).Order("effective_from DESC, id DESC").Find(&prices).Error
+	return prices, err
+}
+
+// getPricesInForce returns the prices of each medicine in force at the given time, by medicine id.
+func getPricesInForce(tx *gorm.DB, medicineIDs []int, at time.Time) (map[int]MedicinePrice, error) {
+	var prices []MedicinePrice
+	query := `
+		SELECT DISTINCT ON (medicine_id)
+			*
+		FROM
+			medicine_prices
+		WHERE
+			medicine_id IN ?
+			AND effective_from <= ?
+		ORDER BY
+			medicine_id, effective_from DESC, id DESC
+	`
+	err := tx.Raw(query, medicineIDs, at).Scan(&prices).Error
+	if err != nil {
+		return nil, err
+	}
+
+	pricesByMedicine := make(map[int]MedicinePrice, len(prices))
+	for _, price := range prices {
+		pricesByMedicine[price.MedicineID] = price
+	}
+	return pricesByMedicine, nil
+}
+
+// BackfillPrices gives medicines created before prices had a history their current price as the first entry,
+// and stock movements made before prices were snapshotted the current selling price and MRP.
+func BackfillPrices(db *gorm.DB) error {
+	err := db.Exec("UPDATE medicines SET cost_price = 0 WHERE cost_price IS NULL").Error
+	if err != nil {
+		return err
+	}
+	err = db.Exec("UPDATE medicines SET mrp = price WHERE mrp IS NULL").Error
+	if err != nil {
+		return err
+	}
+
+	err = db.Exec(`
+		INSERT INTO medicine_prices (medicine_id, cost_price, mrp, selling_price, effective_from, created_at)
+		SELECT m.id, m.cost_price, m.mrp, m.price, m.created_at, NOW()
+		FROM medicines m
+		WHERE NOT EXISTS (SELECT 1 FROM medicine_prices mp WHERE mp.medicine_id = m.id)
+	`).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Exec(`
+		UPDATE stock_updation_particulars sup
+		SET unit_price = m.price, mrp = m.mrp
+		FROM medicines m
+		WHERE sup.medicine_id = m.id AND sup.unit_price IS NULL
+	`).Error
+}
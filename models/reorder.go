@@ -0,0 +1,87 @@
+package models
+
+import (
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ReorderLevelMin     = "min"
+	ReorderLevelOptimal = "optimal"
+)
+
+// GetReorderBill lists the medicines whose current stock is below the given level (min or optimal stock)
+// with the quantity to buy to bring them back to optimal stock, grouped by medicine type and totalled by price.
+func GetReorderBill(db *gorm.DB, level string) (*response.ReorderBill, error) {
+	if level == "" {
+		level = ReorderLevelMin
+	}
+	threshold := "m.min_stock"
+	if level == ReorderLevelOptimal {
+		threshold = "m.optimal_stock"
+	}
+
+	var items []response.StockSummary
+	query := `
+		SELECT
+			m.id AS medicine_id,
+			m.name AS medicine,
+			COALESCE(mt.type, '') AS type,
+			m.current_stock AS quantity,
+			m.min_stock,
+			m.optimal_stock,
+			COALESCE(NULLIF(m.cost_price, 0), m.price) AS unit_price, -- buying price, the selling price until a cost is known
+			m.base_unit
+		FROM
+			medicines m
+		LEFT JOIN
+			med_types mt
+		ON
+			m.type_id = mt.id
+		WHERE
+			m.current_stock < ` + threshold + `
+		ORDER BY
+			mt.type, m.name
+	`
+	err := db.Raw(query).Scan(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	medicineIDs := make([]int, len(items))
+	for i, item := range items {
+		medicineIDs[i] = item.MedicineID
+	}
+	unitsByMedicine, err := getUnitsByMedicineIDs(db, medicineIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	bill := &response.ReorderBill{
+		GeneratedAt: time.Now(),
+		Level:       level,
+		Groups:      []response.ReorderBillGroup{},
+	}
+	for _, item := range items {
+		item.DeficiencyToMinStock = max(item.MinStock-item.Quantity, 0)
+		item.DeficiencyToOptimalStock = max(item.OptimalStock-item.Quantity, 0)
+		item.QuantityToBuy = item.DeficiencyToOptimalStock
+		item.Value = float64(item.QuantityToBuy) * item.UnitPrice
+		item.QuantityInPacks = FormatPacks(item.Quantity, item.BaseUnit, unitsByMedicine[item.MedicineID])
+		item.QuantityToBuyInPacks = FormatPacks(item.QuantityToBuy, item.BaseUnit, unitsByMedicine[item.MedicineID])
+
+		if len(bill.Groups) == 0 || bill.Groups[len(bill.Groups)-1].Type != item.Type {
+			bill.Groups = append(bill.Groups, response.ReorderBillGroup{Type: item.Type})
+		}
+		group := &bill.Groups[len(bill.Groups)-1]
+		group.Items = append(group.Items, item)
+		group.Total += item.Value
+
+		bill.TotalItems++
+		bill.GrandTotal += item.Value
+	}
+
+	return bill, nil
+}
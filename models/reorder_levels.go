@@ -0,0 +1,179 @@
+package models
+
+import (
+	"math"
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultConsumptionDays = 90
+	DefaultCoverDays       = 30
+	DefaultServiceLevel    = 95
+	DefaultLeadTimeDays    = 7 // used when the medicine has no preferred supplier or the supplier has no lead time
+)
+
+// serviceLevelZ is the standard normal quantile for the chance of not running out during a lead time.
+var serviceLevelZ = map[int]float64{
+	90: 1.28,
+	95: 1.65,
+	98: 2.05,
+	99: 2.33,
+}
+
+// ReorderLevel is the min and optimal stock to save for a medicine.
+type ReorderLevel struct {
+	MedicineID   int
+	MinStock     int
+	OptimalStock int
+}
+
+type dailyConsumption struct {
+	MedicineID int `gorm:"column:medicine_id"`
+	Quantity   int `gorm:"column:quantity"`
+}
+
+// GetReorderLevelSuggestions works out min and optimal stock for every medicine sold in the last days, from its
+// average daily consumption and the variability of it over the supplier lead time:
+//
+//	safety stock = z * daily deviation * sqrt(lead time)
+//	min stock    = average daily use * lead time + safety stock
+//	optimal      = min stock + average daily use * cover days
+//
+// Sales are counted net of their reversals. Nothing is saved, see ApplyReorderLevels.
+func GetReorderLevelSuggestions(db *gorm.DB, days, coverDays, serviceLevel int) (*response.ReorderLevelSuggestions, error) {
+	z, ok := serviceLevelZ[serviceLevel]
+	if !ok {
+		z = serviceLevelZ[DefaultServiceLevel]
+		serviceLevel = DefaultServiceLevel
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	var daily []dailyConsumption
+	err := db.Table("stock_updation_particulars sup").
+		Select("sup.medicine_id, SUM(CASE WHEN su.entry_type = ? THEN -sup.quantity ELSE sup.quantity END) AS quantity", EntryTypeReversal).
+		Joins("JOIN stock_updations su ON sup.stock_updation_id = su.id").
+		Where("su.is_addition = ? AND su.kind = ? AND su.brought_at >= ?", false, MovementSale, since).
+		Group("sup.medicine_id, DATE(su.brought_at)").
+		Scan(&daily).Error
+	if err != nil {
+		return nil, err
+	}
+
+	dailyByMedicine := make(map[int][]int)
+	for _, day := range daily {
+		dailyByMedicine[day.MedicineID] = append(dailyByMedicine[day.MedicineID], day.Quantity)
+	}
+
+	suggestions := &response.ReorderLevelSuggestions{
+		Days:         days,
+		CoverDays:    coverDays,
+		ServiceLevel: serviceLevel,
+		Suggestions:  []response.ReorderLevelSuggestion{},
+	}
+	if len(dailyByMedicine) == 0 {
+		return suggestions, nil
+	}
+
+	medicineIDs := make([]int, 0, len(dailyByMedicine))
+	for medicineID := range dailyByMedicine {
+		medicineIDs = append(medicineIDs, medicineID)
+	}
+
+	var lines []response.ReorderLevelSuggestion
+	err = db.Table("medicines m").
+		Select(`m.id AS medicine_id,
+			m.name AS medicine,
+			m.current_stock,
+			m.min_stock,
+			m.optimal_stock,
+			COALESCE(s.lead_time_days, 0) AS lead_time_days`).
+		Joins("LEFT JOIN suppliers s ON m.preferred_supplier_id = s.id").
+		Where("m.id IN ?", medicineIDs).
+		Order("m.name").
+		Scan(&lines).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		suggestReorderLevel(&line, dailyByMedicine[line.MedicineID], days, coverDays, z)
+		suggestions.Suggestions = append(suggestions.Suggestions, line)
+	}
+
+	return suggestions, nil
+}
+
+// suggestReorderLevel fills in the suggested levels of the line from the quantities used on the days
+// the medicine sold, out of the given days, defaulting the lead time when the line has none.
+func suggestReorderLevel(line *response.ReorderLevelSuggestion, dailyQuantities []int, days, coverDays int, z float64) {
+	if line.LeadTimeDays <= 0 {
+		line.LeadTimeDays = DefaultLeadTimeDays
+	}
+
+	// days without sales count as zero use
+	total := 0
+	for _, quantity := range dailyQuantities {
+		total += quantity
+	}
+	mean := float64(total) / float64(days)
+	squares := float64(days-len(dailyQuantities)) * mean * mean
+	for _, quantity := range dailyQuantities {
+		squares += (float64(quantity) - mean) * (float64(quantity) - mean)
+	}
+	deviation := math.Sqrt(squares / float64(days))
+
+	safetyStock := z * deviation * math.Sqrt(float64(line.LeadTimeDays))
+	minStock := mean*float64(line.LeadTimeDays) + safetyStock
+
+	line.AverageDailyUse = math.Round(mean*100) / 100
+	line.DailyUseDeviation = math.Round(deviation*100) / 100
+	line.SafetyStock = int(math.Ceil(safetyStock))
+	line.SuggestedMinStock = int(math.Ceil(minStock))
+	line.SuggestedOptimalStock = int(math.Ceil(minStock + mean*float64(coverDays)))
+}
+
+// ApplyReorderLevels saves the reviewed min and optimal stock levels together, and raises or resolves
+// low stock alerts for the new minimums.
+func ApplyReorderLevels(db *gorm.DB, levels []ReorderLevel) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	medicineIDs := make([]int, len(levels))
+	for i, level := range levels {
+		medicineIDs[i] = level.MedicineID
+	}
+	// locked in id order like the stock movements, so that applying levels cannot deadlock against them
+	err := lockMedicines(tx, medicineIDs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, level := range levels {
+		result := tx.Model(&Medicine{}).Where("id = ?", level.MedicineID).Updates(map[string]interface{}{
+			"min_stock":     level.MinStock,
+			"optimal_stock": level.OptimalStock,
+		})
+		if result.Error != nil {
+			tx.Rollback()
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			tx.Rollback()
+			return gorm.ErrRecordNotFound
+		}
+	}
+
+	err = refreshLowStockAlerts(tx, medicineIDs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
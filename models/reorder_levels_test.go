@@ -0,0 +1,65 @@
+package models
+
+import (
+	"med-manager/domain/response"
+	"testing"
+)
+
+func TestSuggestReorderLevel(t *testing.T) {
+	tests := []struct {
+		name            string
+		leadTimeDays    int
+		dailyQuantities []int
+		days            int
+		coverDays       int
+		z               float64
+		want            response.ReorderLevelSuggestion
+	}{
+		{
+			name:            "steady use has no safety stock",
+			leadTimeDays:    7,
+			dailyQuantities: []int{5, 5, 5, 5, 5, 5, 5, 5, 5, 5},
+			days:            10,
+			coverDays:       30,
+			z:               1.65,
+			want:            response.ReorderLevelSuggestion{LeadTimeDays: 7, AverageDailyUse: 5, SafetyStock: 0, SuggestedMinStock: 35, SuggestedOptimalStock: 185},
+		},
+		{
+			name:            "no lead time uses the default",
+			dailyQuantities: []int{5, 5},
+			days:            2,
+			coverDays:       0,
+			z:               1.65,
+			want:            response.ReorderLevelSuggestion{LeadTimeDays: DefaultLeadTimeDays, AverageDailyUse: 5, SuggestedMinStock: 35, SuggestedOptimalStock: 35},
+		},
+		{
+			name:            "days without sales count as zero use",
+			leadTimeDays:    4,
+			dailyQuantities: []int{8},
+			days:            4,
+			coverDays:       10,
+			z:               1.65,
+			// mean 2, deviation sqrt(48/4), safety 1.65 * 3.46 * 2 = 11.43
+			want: response.ReorderLevelSuggestion{LeadTimeDays: 4, AverageDailyUse: 2, DailyUseDeviation: 3.46, SafetyStock: 12, SuggestedMinStock: 20, SuggestedOptimalStock: 40},
+		},
+		{
+			name:            "levels are rounded up",
+			leadTimeDays:    3,
+			dailyQuantities: []int{1, 3},
+			days:            2,
+			coverDays:       5,
+			z:               1.28,
+			// mean 2, deviation 1, safety 1.28 * sqrt(3) = 2.22
+			want: response.ReorderLevelSuggestion{LeadTimeDays: 3, AverageDailyUse: 2, DailyUseDeviation: 1, SafetyStock: 3, SuggestedMinStock: 9, SuggestedOptimalStock: 19},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := response.ReorderLevelSuggestion{LeadTimeDays: tt.leadTimeDays}
+			suggestReorderLevel(&line, tt.dailyQuantities, tt.days, tt.coverDays, tt.z)
+			if line != tt.want {
+				t.Errorf("got %+v, want %+v", line, tt.want)
+			}
+		})
+	}
+}
@@ -1,14 +1,98 @@
 package models
 
+import "time"
+
 type StockUpdateRequest struct {
 	StockChanges []StockChanges `json:"stock_changes" validate:"required,dive"`
+	AllowExpired bool           `json:"allow_expired"`                          // allow dispensing from lots that are already expired
+	LocationID   int            `json:"location_id" validate:"omitempty,gte=1"` // the default location when not given
+	Kind         string         `json:"kind" validate:"omitempty,oneof=sale damaged expired_write_off returned_to_supplier theft_loss"`
+	Reason       string         `json:"reason"`
+}
+
+type StockAdditionRequest struct {
+	StockChanges []StockAdditionChanges `json:"stock_changes" validate:"required,dive"`
+	LocationID   int                    `json:"location_id" validate:"omitempty,gte=1"` // the default location when not given
+	Kind         string                 `json:"kind" validate:"omitempty,oneof=purchase opening_balance customer_return"`
+	Reason       string                 `json:"reason"`
 }
 
+// UpdateStockUpdateRequest corrects the particulars of a stock updation.
+// Batch details are only used when the updation being corrected is an addition.
 type UpdateStockUpdateRequest struct {
-	StockChanges []StockChanges `json:"stock_changes"`
+	StockChanges []StockCorrectionChanges `json:"stock_changes" validate:"required,min=1,dive"`
+	AllowExpired bool                     `json:"allow_expired"`
+	Reason       string                   `json:"reason"`
+	UpdatedBy    string                   `json:"updated_by"`
+}
+
+// StockCorrectionChanges is a line of a correction. It has the fields of StockAdditionChanges, but the batch
+// details are only required, by addToLot, when the updation being corrected is an addition.
+type StockCorrectionChanges struct {
+	StockChanges
+	UnitCost       float64   `json:"unit_cost" validate:"gte=0"`
+	BatchNo        string    `json:"batch_no"`
+	ManufacturedAt time.Time `json:"manufactured_at"`
+	ExpiresAt      time.Time `json:"expires_at" validate:"omitempty,gtfield=ManufacturedAt"`
+}
+
+// InvoiceRequest bills either a sale deduction or a visit's prescription, dispensing it first
+// from the location when it is not dispensed yet. A visit's patient is always the invoice's patient.
+type InvoiceRequest struct {
+	StockUpdationID *int `json:"stock_updation_id" validate:"required_without=VisitID,excluded_with=VisitID,omitempty,gte=1"`
+	VisitID         *int `json:"visit_id" validate:"omitempty,gte=1"`
+	PatientID       *int `json:"patient_id" validate:"omitempty,gte=1"`
+	LocationID      int  `json:"location_id" validate:"omitempty,gte=1"`
+	AllowExpired    bool `json:"allow_expired"`
+	Issue           bool `json:"issue"` // issue the invoice instead of keeping it as a draft
+	InvoiceChargesRequest
+}
+
+// InvoiceChargesRequest is the discount of an invoice in percent, a line's discount overriding the invoice's,
+// and whether the supply is inter-state and so taxed as IGST.
+type InvoiceChargesRequest struct {
+	DiscountPercent float64                    `json:"discount_percent" validate:"gte=0,lte=100"`
+	InterState      bool                       `json:"inter_state"`
+	Lines           []InvoiceLineChargeRequest `json:"lines" validate:"omitempty,dive"`
+	Notes           string                     `json:"notes"`
+}
+
+type InvoiceLineChargeRequest struct {
+	MedicineID      int     `json:"medicine_id" validate:"required,gte=1"`
+	DiscountPercent float64 `json:"discount_percent" validate:"gte=0,lte=100"`
+}
+
+type StockTransferRequest struct {
+	FromLocationID int            `json:"from_location_id" validate:"required,gte=1"`
+	ToLocationID   int            `json:"to_location_id" validate:"required,gte=1"`
+	StockChanges   []StockChanges `json:"stock_changes" validate:"required,min=1,dive"`
+	AllowExpired   bool           `json:"allow_expired"`
+	TransferredBy  string         `json:"transferred_by"`
+	Notes          string         `json:"notes"`
+}
+
+type StockUpdationListRequest struct {
+	LocationID int    `query:"location_id" validate:"gte=0"`
+	Kind       string `query:"kind"`
+	Page       int    `query:"page" validate:"gte=0"`
+	Limit      int    `query:"limit" validate:"gte=0"`
+}
+
+type VoidStockUpdationRequest struct {
+	Reason   string `query:"reason" validate:"required"`
+	VoidedBy string `query:"voided_by" validate:"required"`
 }
 
 type StockChanges struct {
-	MedicineID int `json:"medicine_id" validate:"required,gte=1"`
-	Quantity   int `json:"quantity" validate:"required,gte=1"`
+	MedicineID int    `json:"medicine_id" validate:"required,gte=1"`
+	Quantity   int    `json:"quantity" validate:"required,gte=1"`
+	Unit       string `json:"unit"` // a pack of the medicine, or its base unit when empty
+}
+
+type StockAdditionChanges struct {
+	StockChanges
+	UnitCost       float64   `json:"unit_cost" validate:"gte=0"` // purchase cost of one unit as given, the lot's cost when 0
+	BatchNo        string    `json:"batch_no" validate:"required"`
+	ManufacturedAt time.Time `json:"manufactured_at" validate:"required"`
+	ExpiresAt      time.Time `json:"expires_at" validate:"required,gtfield=ManufacturedAt"`
 }
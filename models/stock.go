@@ -3,109 +3,151 @@ package models
 import (
 	"fmt"
 	"med-manager/domain/response"
+	"sort"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var ErrInsufficientStock = fmt.Errorf("Insufficient stock")
 
-func (sReq *StockUpdateRequest) AddToStock(db *gorm.DB) error {
+// lockMedicines takes row locks on the medicines in ascending id order, so that concurrent
+// stock movements on overlapping medicines wait for each other instead of deadlocking.
+func lockMedicines(tx *gorm.DB, medicineIDs []int) error {
+	if len(medicineIDs) == 0 {
+		return nil
+	}
+	ids := make([]int, len(medicineIDs))
+	copy(ids, medicineIDs)
+	sort.Ints(ids)
+
+	var lockedIDs []int
+	return tx.Model(&Medicine{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", ids).Order("id").Pluck("id", &lockedIDs).Error
+}
+
+// isCheckViolation reports whether err is a CHECK constraint violation, like stock going below zero.
+func isCheckViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "(SQLSTATE 23514)")
+}
+
+func (sReq *StockAdditionRequest) AddToStock(db *gorm.DB) error {
+	kind, err := checkMovementKind(sReq.Kind, sReq.Reason, true)
+	if err != nil {
+		return err
+	}
+
 	tx := db.Begin()
 	if tx.Error != nil {
 		return tx.Error
 	}
 
+	err = convertStockAdditionChanges(tx, sReq.StockChanges)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	locationID, err := resolveLocationID(tx, sReq.LocationID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	stockUpdation := &StockUpdation{
-		BroughtAt: time.Now(),
-		IsAddtion: true,
+		BroughtAt:  time.Now(),
+		IsAddtion:  true,
+		Kind:       kind,
+		LocationID: locationID,
+		Reason:     sReq.Reason,
 	}
-	err := tx.Create(stockUpdation).Error
+	err = tx.Create(stockUpdation).Error
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	for _, stockChange := range sReq.StockChanges {
-		stockUpdationParticulars := &StockUpdationParticulars{
-			StockUpdationID: stockUpdation.ID,
-			MedicineID:      stockChange.MedicineID,
-			Quantity:        stockChange.Quantity,
-		}
-		err := tx.Create(stockUpdationParticulars).Error
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
+	err = addStockParticulars(tx, stockUpdation.ID, locationID, sReq.StockChanges)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 
-		//add stockChange.Quantity to Medicine.CurrentStock
-		var medicine Medicine
-		err = tx.Model(&medicine).Where("id = ?", stockChange.MedicineID).Update("current_stock", gorm.Expr("current_stock + ?", stockChange.Quantity)).Error
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
+	err = recordPurchaseTax(tx, stockUpdation)
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 
 	return tx.Commit().Error
 }
 
-func (sReq *StockUpdateRequest) DeductFromStock(db *gorm.DB) (error, int) {
+func (sReq *StockUpdateRequest) DeductFromStock(db *gorm.DB) (*response.StockDeductionResponse, error, int) {
+	kind, err := checkMovementKind(sReq.Kind, sReq.Reason, false)
+	if err != nil {
+		return nil, err, 0
+	}
+	// writing off expired stock is the one deduction meant to draw from expired lots
+	allowExpired := sReq.AllowExpired || kind == MovementExpiredWriteOff
+
 	tx := db.Begin()
 	if tx.Error != nil {
-		return tx.Error, 0
+		return nil, tx.Error, 0
 	}
 
-	stockUpdation := &StockUpdation{
-		BroughtAt: time.Now(),
-		IsAddtion: false,
-	}
-	err := tx.Create(stockUpdation).Error
+	err = convertStockChanges(tx, sReq.StockChanges)
 	if err != nil {
 		tx.Rollback()
-		return err, 0
+		return nil, err, 0
 	}
 
-	for _, stockChange := range sReq.StockChanges {
-		stockUpdationParticulars := &StockUpdationParticulars{
-			StockUpdationID: stockUpdation.ID,
-			MedicineID:      stockChange.MedicineID,
-			Quantity:        stockChange.Quantity,
-		}
-		err := tx.Create(stockUpdationParticulars).Error
-		if err != nil {
-			tx.Rollback()
-			return err, 0
-		}
+	locationID, err := resolveLocationID(tx, sReq.LocationID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err, 0
+	}
 
-		//get current stock
-		var currentStock int
-		err = tx.Raw("SELECT current_stock FROM medicines WHERE id = ?", stockChange.MedicineID).Scan(&currentStock).Error
-		if err != nil {
-			tx.Rollback()
-			return err, 0
-		}
+	stockUpdation := &StockUpdation{
+		BroughtAt:  time.Now(),
+		IsAddtion:  false,
+		Kind:       kind,
+		LocationID: locationID,
+		Reason:     sReq.Reason,
+	}
+	err = tx.Create(stockUpdation).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err, 0
+	}
 
-		if currentStock < stockChange.Quantity {
-			tx.Rollback()
-			return ErrInsufficientStock, stockChange.MedicineID
-		}
+	allocations, err, insufficientMedID := deductStockParticulars(tx, stockUpdation.ID, locationID, sReq.StockChanges, allowExpired)
+	if err != nil {
+		tx.Rollback()
+		return nil, err, insufficientMedID
+	}
 
-		//deduct stockChange.Quantity from Medicine.CurrentStock
-		var medicine Medicine
-		err = tx.Model(&medicine).Where("id = ?", stockChange.MedicineID).Update("current_stock", gorm.Expr("current_stock - ?", stockChange.Quantity)).Error
-		if err != nil {
-			tx.Rollback()
-			return err, 0
-		}
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err, 0
 	}
 
-	return tx.Commit().Error, 0
+	return &response.StockDeductionResponse{
+		StockUpdationID: stockUpdation.ID,
+		Allocations:     allocations,
+	}, nil, 0
 }
 
-func GetAllStockUpdations(db *gorm.DB, isAddtion bool, offset, limit int) ([]response.GetStockUpdationResponse, error) {
+func GetAllStockUpdations(db *gorm.DB, isAddtion bool, kind string, locationID, offset, limit int) ([]response.GetStockUpdationResponse, error) {
 	var stockAdditions []response.GetStockUpdationResponse
-	err := db.Table("stock_updations").Where("is_addition = ?", isAddtion).Offset(offset).Limit(limit).Find(&stockAdditions).Error
+	query := db.Table("stock_updations").Where("is_addition = ?", isAddtion)
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if locationID != 0 {
+		query = query.Where("location_id = ?", locationID)
+	}
+	err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&stockAdditions).Error
 	if err != nil {
 		return nil, err
 	}
@@ -115,6 +157,11 @@ func GetAllStockUpdations(db *gorm.DB, isAddtion bool, offset, limit int) ([]res
 		if err != nil {
 			return nil, err
 		}
+
+		stockAdditions[i].Lots, err = getStockUpdationLotDetails(db, stockAdditions[i].ID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return stockAdditions, nil
@@ -132,82 +179,41 @@ func GetStockUpdationByID(db *gorm.DB, id int) (*response.GetStockUpdationRespon
 		return nil, err
 	}
 
-	return &stockAddition, nil
-}
-
-func DeleteStockUpdation(db *gorm.DB, id int) error {
-	var stockUpdation StockUpdation
-	err := db.Where("id = ?", id).First(&stockUpdation).Error
-	if err != nil {
-		return err
-	}
-
-	var stockUpdationParticulars []StockUpdationParticulars
-	err = db.Where("stock_updation_id = ?", id).Find(&stockUpdationParticulars).Error
+	stockAddition.Lots, err = getStockUpdationLotDetails(db, stockAddition.ID)
 	if err != nil {
-		db.Rollback()
-		return err
-	}
-
-	tx := db.Begin()
-	if tx.Error != nil {
-		return tx.Error
-	}
-
-	fmt.Println("stockUpdationParticulars: ", stockUpdationParticulars)
-	for i := range stockUpdationParticulars {
-		// adjusting stock to undo the stock updation
-		var stockChangeToDo int
-		if stockUpdation.IsAddtion {
-			stockChangeToDo = -stockUpdationParticulars[i].Quantity
-		} else {
-			stockChangeToDo = stockUpdationParticulars[i].Quantity
-		}
-		var medicine Medicine
-		err = tx.Model(&medicine).Where("id = ?", stockUpdationParticulars[i].MedicineID).Update("current_stock", gorm.Expr("current_stock + ?", stockChangeToDo)).Error
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
-	}
-
-	err = tx.Delete(&StockUpdation{}, id).Error
-	if err != nil {
-		tx.Rollback()
-		return err
+		return nil, err
 	}
 
-	return tx.Commit().Error
+	return &stockAddition, nil
 }
 
-func DeleteStockUpdationParticulars(db *gorm.DB, stockUpdationID, medicineID int) error {
-	tx := db.Begin()
-	if tx.Error != nil {
-		return tx.Error
-	}
-
-	//deduct stockChange.Quantity from Medicine.CurrentStock
-	var stockUpdationParticular StockUpdationParticulars
-	err := tx.Where("stock_updation_id = ? AND medicine_id = ?", stockUpdationID, medicineID).First(&stockUpdationParticular).Error
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-
-	var medicine Medicine
-	err = tx.Model(&medicine).Where("id = ?", stockUpdationParticular.MedicineID).Update("current_stock", gorm.Expr("current_stock - ?", stockUpdationParticular.Quantity)).Error
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-
-	err = tx.Delete(&StockUpdationParticulars{}, "stock_updation_id = ? AND medicine_id = ?", stockUpdationID, medicineID).Error
+func getStockUpdationLotDetails(db *gorm.DB, stockUpdationID int) ([]response.StockUpdationLotDetails, error) {
+	var lots []response.StockUpdationLotDetails
+	query := `
+		SELECT
+			sul.stock_lot_id,
+			sul.medicine_id,
+			sl.batch_no,
+			sl.expires_at,
+			sul.quantity,
+			sul.unit_cost
+		FROM
+			stock_updation_lots sul
+		JOIN
+			stock_lots sl
+		ON
+			sul.stock_lot_id = sl.id
+		WHERE
+			sul.stock_updation_id = ?
+		ORDER BY
+			sl.expires_at
+	`
+	err := db.Raw(query, stockUpdationID).Scan(&lots).Error
 	if err != nil {
-		tx.Rollback()
-		return err
+		return nil, err
 	}
 
-	return tx.Commit().Error
+	return lots, nil
 }
 
 func GetStockUpdationParticularsByStockUpdationID(db *gorm.DB, stockUpdationID int) ([]StockUpdationParticulars, error) {
@@ -220,13 +226,16 @@ func GetStockUpdationParticularsByStockUpdationID(db *gorm.DB, stockUpdationID i
 	return stockUpdationParticulars, nil
 }
 
-func GetStockUpdationParticularsByMedicineID(db *gorm.DB, medicineID int, isAddition bool) ([]response.MedicineWiseStockUpdationDetails, error) {
+func GetStockUpdationParticularsByMedicineID(db *gorm.DB, medicineID int, isAddition bool, kind string) ([]response.MedicineWiseStockUpdationDetails, error) {
 	var stockUpdationParticulars []response.MedicineWiseStockUpdationDetails
 	query := `
 		SELECT
 			sup.stock_updation_id,
 			su.brought_at,
-			sup.quantity
+			sup.quantity,
+			su.kind,
+			su.entry_type,
+			su.voided_at
 		FROM
 			stock_updation_particulars sup
 		JOIN
@@ -236,8 +245,11 @@ func GetStockUpdationParticularsByMedicineID(db *gorm.DB, medicineID int, isAddi
 		WHERE
 			sup.medicine_id = ?
 			AND su.is_addition = ?
+			AND (? = '' OR su.kind = ?)
+		ORDER BY
+			su.brought_at, su.id
 	`
-	err := db.Raw(query, medicineID, isAddition).Scan(&stockUpdationParticulars).Error
+	err := db.Raw(query, medicineID, isAddition, kind, kind).Scan(&stockUpdationParticulars).Error
 	if err != nil {
 		return nil, err
 	}
@@ -245,87 +257,6 @@ func GetStockUpdationParticularsByMedicineID(db *gorm.DB, medicineID int, isAddi
 	return stockUpdationParticulars, nil
 }
 
-func UpdateParticularsInAnStockUpdation(db *gorm.DB, stockUpdationID int, stockChanges []StockChanges) error {
-	tx := db.Begin()
-	if tx.Error != nil {
-		return tx.Error
-	}
-
-	var oldParticulars []StockUpdationParticulars
-	err := tx.Where("stock_updation_id = ?", stockUpdationID).Find(&oldParticulars).Error
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-
-	oldParticularsMap := make(map[int]int)
-	for i := range oldParticulars {
-		oldParticularsMap[oldParticulars[i].MedicineID] = oldParticulars[i].Quantity
-	}
-
-	for i := range stockChanges {
-		quantity, ok := oldParticularsMap[stockChanges[i].MedicineID]
-		if !ok {
-			//add new particular
-			stockUpdationParticulars := &StockUpdationParticulars{
-				StockUpdationID: stockUpdationID,
-				MedicineID:      stockChanges[i].MedicineID,
-				Quantity:        stockChanges[i].Quantity,
-			}
-			err := tx.Create(stockUpdationParticulars).Error
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
-
-			//add stockChange.Quantity to Medicine.CurrentStock
-			var medicine Medicine
-			err = tx.Model(&medicine).Where("id = ?", stockChanges[i].MedicineID).Update("current_stock", gorm.Expr("current_stock + ?", stockChanges[i].Quantity)).Error
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
-
-		} else {
-			//update particular
-			err := tx.Model(&StockUpdationParticulars{}).Where("stock_updation_id = ? AND medicine_id = ?", stockUpdationID, stockChanges[i].MedicineID).Update("quantity", stockChanges[i].Quantity).Error
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
-
-			//update Medicine.CurrentStock
-			var medicine Medicine
-			err = tx.Model(&medicine).Where("id = ?", stockChanges[i].MedicineID).Update("current_stock", gorm.Expr("current_stock + ?", stockChanges[i].Quantity-quantity)).Error
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
-
-			delete(oldParticularsMap, stockChanges[i].MedicineID)
-		}
-	}
-
-	for medicineID, quantity := range oldParticularsMap {
-		//delete particular
-		err := tx.Delete(&StockUpdationParticulars{}, "stock_updation_id = ? AND medicine_id = ?", stockUpdationID, medicineID).Error
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
-
-		//deduct stockChange.Quantity from Medicine.CurrentStock
-		var medicine Medicine
-		err = tx.Model(&medicine).Where("id = ?", medicineID).Update("current_stock", gorm.Expr("current_stock - ?", quantity)).Error
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
-	}
-
-	return tx.Commit().Error
-}
-
 func GetMedicineStockByMedicineID(db *gorm.DB, medicineID int) (int, error) {
 	var currentStock int
 	err := db.Raw("SELECT current_stock FROM medicines WHERE id = ?", medicineID).Scan(&currentStock).Error
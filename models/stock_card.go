@@ -0,0 +1,98 @@
+package models
+
+import (
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// signedQuantitySQL is the effect of a particulars row on stock: additions increase it, deductions decrease it,
+// and a reversal has the opposite effect of the entry it reverses.
+const signedQuantitySQL = `CASE WHEN su.is_addition <> (su.entry_type = 'reversal') THEN sup.quantity ELSE -sup.quantity END`
+
+// GetStockCard lists every movement of a medicine between from and to (both optional, to is inclusive)
+// in chronological order with the running balance, like a bin card. A non-zero locationID keeps
+// to the movements at that location, so a transfer shows as out at one and in at the other.
+func GetStockCard(db *gorm.DB, medicineID, locationID int, from, to *time.Time) (*response.StockCard, error) {
+	medicine, err := GetMedicineByID(db, medicineID)
+	if err != nil {
+		return nil, err
+	}
+
+	card := &response.StockCard{
+		MedicineID: medicine.ID,
+		Medicine:   medicine.Name,
+		LocationID: locationID,
+		From:       from,
+		To:         to,
+		Movements:  []response.StockCardEntry{},
+	}
+
+	if from != nil {
+		query := `
+			SELECT
+				COALESCE(SUM(` + signedQuantitySQL + `), 0)
+			FROM
+				stock_updation_particulars sup
+			JOIN
+				stock_updations su
+			ON
+				sup.stock_updation_id = su.id
+			WHERE
+				sup.medicine_id = ?
+				AND su.brought_at < ?
+				AND (? = 0 OR su.location_id = ?)
+		`
+		err = db.Raw(query, medicineID, *from, locationID, locationID).Scan(&card.OpeningBalance).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query := db.Table("stock_updation_particulars sup").
+		Select(`su.id AS stock_updation_id,
+			su.brought_at,
+			su.is_addition,
+			su.kind,
+			su.entry_type,
+			su.reference_id,
+			su.location_id,
+			su.transfer_id,
+			su.supplier_id,
+			su.purchase_order_id,
+			su.visit_id,
+			su.voided_at,
+			su.reason,
+			`+signedQuantitySQL+` AS quantity`).
+		Joins("JOIN stock_updations su ON sup.stock_updation_id = su.id").
+		Where("sup.medicine_id = ?", medicineID)
+	if locationID != 0 {
+		query = query.Where("su.location_id = ?", locationID)
+	}
+	if from != nil {
+		query = query.Where("su.brought_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("su.brought_at < ?", to.AddDate(0, 0, 1))
+	}
+	err = query.Order("su.brought_at, su.id").Scan(&card.Movements).Error
+	if err != nil {
+		return nil, err
+	}
+
+	balance := card.OpeningBalance
+	for i := range card.Movements {
+		movement := &card.Movements[i]
+		if movement.Quantity >= 0 {
+			movement.In = movement.Quantity
+		} else {
+			movement.Out = -movement.Quantity
+		}
+		balance += movement.Quantity
+		movement.Balance = balance
+	}
+	card.ClosingBalance = balance
+
+	return card, nil
+}
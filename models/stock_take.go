@@ -0,0 +1,345 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StockTakeOpen      = "open"
+	StockTakeFinalised = "finalised"
+	StockTakeCancelled = "cancelled"
+
+	StockTakeReason = "stock take"
+)
+
+var (
+	ErrStockTakeClosed = fmt.Errorf("Stock take is not open")
+	ErrNoLotForSurplus = fmt.Errorf("Medicine has no lot to put the counted surplus into")
+)
+
+// StockTake is a physical count session at a location. Counts can be submitted in several parts while it is open,
+// and finalising it posts the variances to the stock ledger as adjustments.
+type StockTake struct {
+	ID          int        `json:"id" gorm:"column:id;primaryKey"`
+	LocationID  int        `json:"location_id" gorm:"column:location_id"`
+	Status      string     `json:"status" gorm:"column:status;default:open"`
+	Notes       string     `json:"notes" gorm:"column:notes"`
+	StartedBy   string     `json:"started_by" gorm:"column:started_by"`
+	StartedAt   time.Time  `json:"started_at" gorm:"column:started_at"`
+	FinalisedAt *time.Time `json:"finalised_at" gorm:"column:finalised_at"`
+	AdditionID  *int       `json:"addition_id" gorm:"column:addition_id"`   // stock updation posting the surpluses
+	DeductionID *int       `json:"deduction_id" gorm:"column:deduction_id"` // stock updation posting the shortages
+}
+
+type StockTakeCount struct {
+	StockTakeID     int       `json:"stock_take_id" gorm:"column:stock_take_id;primaryKey"`
+	MedicineID      int       `json:"medicine_id" gorm:"column:medicine_id;primaryKey"`
+	CountedQuantity int       `json:"counted_quantity" gorm:"column:counted_quantity"`
+	SystemQuantity  *int      `json:"system_quantity" gorm:"column:system_quantity"` // stock at the location when counted
+	CountedBy       string    `json:"counted_by" gorm:"column:counted_by"`
+	CountedAt       time.Time `json:"counted_at" gorm:"column:counted_at"`
+
+	StockTake StockTake `json:"-" gorm:"foreignKey:StockTakeID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Medicine  Medicine  `json:"-" gorm:"foreignKey:MedicineID;references:ID"`
+}
+
+func (s *StockTake) Create(db *gorm.DB) error {
+	locationID, err := resolveLocationID(db, s.LocationID)
+	if err != nil {
+		return err
+	}
+
+	s.ID = 0
+	s.LocationID = locationID
+	s.Status = StockTakeOpen
+	s.StartedAt = time.Now()
+	return db.Create(s).Error
+}
+
+func GetAllStockTakes(db *gorm.DB, offset, limit int) ([]StockTake, error) {
+	var stockTakes []StockTake
+	err := db.Order("started_at DESC").Offset(offset).Limit(limit).Find(&stockTakes).Error
+	return stockTakes, err
+}
+
+// SubmitStockTakeCounts saves counted quantities into an open stock take.
+// A medicine counted again replaces its earlier count.
+func SubmitStockTakeCounts(db *gorm.DB, stockTakeID int, counts []StockTakeCount) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	stockTake, err := lockOpenStockTake(tx, stockTakeID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// keep the last count of a medicine repeated within the submission
+	positions := make(map[int]int)
+	uniqueCounts := []StockTakeCount{}
+	for i := range counts {
+		counts[i].StockTakeID = stockTakeID
+		counts[i].CountedAt = time.Now()
+		if position, ok := positions[counts[i].MedicineID]; ok {
+			uniqueCounts[position] = counts[i]
+			continue
+		}
+		positions[counts[i].MedicineID] = len(uniqueCounts)
+		uniqueCounts = append(uniqueCounts, counts[i])
+	}
+	counts = uniqueCounts
+
+	// the variance is against the stock when counted, so that sales and receipts made between
+	// counting and finalising are not posted as surpluses or shortages
+	for i := range counts {
+		systemQuantity, err := getLocationStockQuantity(tx, stockTake.LocationID, counts[i].MedicineID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		counts[i].SystemQuantity = &systemQuantity
+	}
+
+	if len(counts) > 0 {
+		err = tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "stock_take_id"}, {Name: "medicine_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"counted_quantity", "system_quantity", "counted_by", "counted_at"}),
+		}).Create(&counts).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+func lockOpenStockTake(tx *gorm.DB, stockTakeID int) (*StockTake, error) {
+	var stockTake StockTake
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&stockTake, stockTakeID).Error
+	if err != nil {
+		return nil, err
+	}
+	if stockTake.Status != StockTakeOpen {
+		return nil, ErrStockTakeClosed
+	}
+	return &stockTake, nil
+}
+
+// GetStockTakeReport returns the stock take with the variance of every counted medicine
+// against its stock at the location when it was counted, valued at the medicine price.
+func GetStockTakeReport(db *gorm.DB, stockTakeID int) (*response.StockTakeReport, error) {
+	var stockTake StockTake
+	err := db.First(&stockTake, stockTakeID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	report := &response.StockTakeReport{
+		ID:          stockTake.ID,
+		LocationID:  stockTake.LocationID,
+		Status:      stockTake.Status,
+		Notes:       stockTake.Notes,
+		StartedBy:   stockTake.StartedBy,
+		StartedAt:   stockTake.StartedAt,
+		FinalisedAt: stockTake.FinalisedAt,
+		AdditionID:  stockTake.AdditionID,
+		DeductionID: stockTake.DeductionID,
+	}
+	report.Lines, err = getStockTakeVariances(db, stockTakeID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range report.Lines {
+		if line.Variance > 0 {
+			report.SurplusValue += line.ValueImpact
+		} else {
+			report.ShortageValue -= line.ValueImpact
+		}
+		report.NetValueImpact += line.ValueImpact
+	}
+
+	return report, nil
+}
+
+func getStockTakeVariances(db *gorm.DB, stockTakeID int) ([]response.StockTakeVariance, error) {
+	lines := []response.StockTakeVariance{}
+	query := `
+		SELECT
+			stc.medicine_id,
+			m.name AS medicine,
+			COALESCE(stc.system_quantity, (
+				SELECT SUM(sl.quantity) FROM stock_lots sl WHERE sl.medicine_id = stc.medicine_id AND sl.location_id = st.location_id
+			), 0) AS system_quantity,
+			stc.counted_quantity,
+			stc.counted_by,
+			stc.counted_at,
+			m.price AS unit_price
+		FROM
+			stock_take_counts stc
+		JOIN
+			stock_takes st
+		ON
+			stc.stock_take_id = st.id
+		JOIN
+			medicines m
+		ON
+			stc.medicine_id = m.id
+		WHERE
+			stc.stock_take_id = ?
+		ORDER BY
+			m.name
+	`
+	err := db.Raw(query, stockTakeID).Scan(&lines).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range lines {
+		lines[i].Variance = lines[i].CountedQuantity - lines[i].SystemQuantity
+		lines[i].ValueImpact = float64(lines[i].Variance) * lines[i].UnitPrice
+	}
+	return lines, nil
+}
+
+// FinaliseStockTake posts the surpluses as an addition and the shortages as a deduction, both as
+// adjustment entries with the reason "stock take", and closes the session. On failure the medicine id is returned.
+func FinaliseStockTake(db *gorm.DB, stockTakeID int) (error, int) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error, 0
+	}
+
+	stockTake, err := lockOpenStockTake(tx, stockTakeID)
+	if err != nil {
+		tx.Rollback()
+		return err, 0
+	}
+
+	var medicineIDs []int
+	err = tx.Model(&StockTakeCount{}).Where("stock_take_id = ?", stockTakeID).Pluck("medicine_id", &medicineIDs).Error
+	if err != nil {
+		tx.Rollback()
+		return err, 0
+	}
+	err = lockMedicines(tx, medicineIDs)
+	if err != nil {
+		tx.Rollback()
+		return err, 0
+	}
+
+	// counts from before the stock was recorded with them are compared to the stock now, after locking
+	variances, err := getStockTakeVariances(tx, stockTakeID)
+	if err != nil {
+		tx.Rollback()
+		return err, 0
+	}
+
+	surpluses := []StockAdditionChanges{}
+	shortages := []StockChanges{}
+	for _, line := range variances {
+		if line.Variance < 0 {
+			shortages = append(shortages, StockChanges{MedicineID: line.MedicineID, Quantity: -line.Variance})
+		}
+		if line.Variance > 0 {
+			// the surplus goes into the latest batch, preferring one already kept at the location
+			var lot StockLot
+			err = tx.Where("medicine_id = ?", line.MedicineID).
+				Order(clause.Expr{SQL: "location_id = ? DESC, expires_at DESC, id DESC", Vars: []interface{}{stockTake.LocationID}}).
+				First(&lot).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				tx.Rollback()
+				return ErrNoLotForSurplus, line.MedicineID
+			}
+			if err != nil {
+				tx.Rollback()
+				return err, 0
+			}
+			surpluses = append(surpluses, StockAdditionChanges{
+				StockChanges:   StockChanges{MedicineID: line.MedicineID, Quantity: line.Variance},
+				UnitCost:       lot.UnitCost,
+				BatchNo:        lot.BatchNo,
+				ManufacturedAt: lot.ManufacturedAt,
+				ExpiresAt:      lot.ExpiresAt,
+			})
+		}
+	}
+
+	updates := map[string]interface{}{
+		"status":       StockTakeFinalised,
+		"finalised_at": time.Now(),
+	}
+
+	if len(surpluses) > 0 {
+		addition := &StockUpdation{
+			BroughtAt:  time.Now(),
+			IsAddtion:  true,
+			Kind:       MovementStockTake,
+			EntryType:  EntryTypeAdjustment,
+			LocationID: stockTake.LocationID,
+			Reason:     StockTakeReason,
+		}
+		err = tx.Create(addition).Error
+		if err != nil {
+			tx.Rollback()
+			return err, 0
+		}
+		err = addStockParticulars(tx, addition.ID, stockTake.LocationID, surpluses)
+		if err != nil {
+			tx.Rollback()
+			return err, 0
+		}
+		updates["addition_id"] = addition.ID
+	}
+
+	if len(shortages) > 0 {
+		deduction := &StockUpdation{
+			BroughtAt:  time.Now(),
+			IsAddtion:  false,
+			Kind:       MovementStockTake,
+			EntryType:  EntryTypeAdjustment,
+			LocationID: stockTake.LocationID,
+			Reason:     StockTakeReason,
+		}
+		err = tx.Create(deduction).Error
+		if err != nil {
+			tx.Rollback()
+			return err, 0
+		}
+		// the stock is physically gone, so expired lots are written off first like any other
+		_, err, insufficientMedID := deductStockParticulars(tx, deduction.ID, stockTake.LocationID, shortages, true)
+		if err != nil {
+			tx.Rollback()
+			return err, insufficientMedID
+		}
+		updates["deduction_id"] = deduction.ID
+	}
+
+	err = tx.Model(&StockTake{}).Where("id = ?", stockTakeID).Updates(updates).Error
+	if err != nil {
+		tx.Rollback()
+		return err, 0
+	}
+
+	return tx.Commit().Error, 0
+}
+
+func CancelStockTake(db *gorm.DB, stockTakeID int) error {
+	result := db.Model(&StockTake{}).Where("id = ? AND status = ?", stockTakeID, StockTakeOpen).Update("status", StockTakeCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStockTakeClosed
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB connects to the Postgres database in TEST_DATABASE_DSN and migrates the tables stock
+// movements use. The test is skipped when it is not set.
+func openTestDB(t *testing.T) *gorm.DB {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+
+	err = db.AutoMigrate(
+		&Location{},
+		&Supplier{},
+		&Medicine{},
+		&MedicineUnit{},
+		&MedType{},
+		&MedicinePrice{},
+		&Patient{},
+		&Visit{},
+		&PurchaseOrder{},
+		&PurchaseOrderLine{},
+		&StockUpdation{},
+		&StockUpdationParticulars{},
+		&StockLot{},
+		&StockUpdationLot{},
+		&Alert{},
+	)
+	if err != nil {
+		t.Fatalf("migrating the test database: %v", err)
+	}
+	if err := BackfillLocations(db); err != nil {
+		t.Fatalf("creating the default location: %v", err)
+	}
+	if err := CreateAlertIndexes(db); err != nil {
+		t.Fatalf("creating the alert indexes: %v", err)
+	}
+	return db
+}
+
+// createTestMedicine creates a medicine with a unique name holding stock in one lot at the default location.
+func createTestMedicine(t *testing.T, db *gorm.DB, stock int) *Medicine {
+	suffix := time.Now().UnixNano()
+	medType := &MedType{Type: fmt.Sprintf("test type %d", suffix)}
+	if err := medType.Create(db); err != nil {
+		t.Fatalf("creating the medicine type: %v", err)
+	}
+	medicine := &Medicine{
+		Name:         fmt.Sprintf("test medicine %d", suffix),
+		TypeID:       medType.ID,
+		Price:        10,
+		MRP:          12,
+		MinStock:     0,
+		OptimalStock: stock,
+	}
+	if err := medicine.Create(db); err != nil {
+		t.Fatalf("creating the medicine: %v", err)
+	}
+
+	addition := &StockAdditionRequest{
+		StockChanges: []StockAdditionChanges{{
+			StockChanges:   StockChanges{MedicineID: medicine.ID, Quantity: stock},
+			UnitCost:       5,
+			BatchNo:        fmt.Sprintf("B%d", suffix),
+			ManufacturedAt: time.Now().AddDate(0, -1, 0),
+			ExpiresAt:      time.Now().AddDate(1, 0, 0),
+		}},
+	}
+	if err := addition.AddToStock(db); err != nil {
+		t.Fatalf("adding stock: %v", err)
+	}
+	return medicine
+}
+
+func TestDeductFromStockDoesNotOversell(t *testing.T) {
+	db := openTestDB(t)
+
+	const stock, requests, quantity = 10, 25, 3
+	medicine := createTestMedicine(t, db, stock)
+
+	var wg sync.WaitGroup
+	errs := make([]error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := &StockUpdateRequest{
+				StockChanges: []StockChanges{{MedicineID: medicine.ID, Quantity: quantity}},
+			}
+			_, errs[i], _ = req.DeductFromStock(db)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch err {
+		case nil:
+			succeeded++
+		case ErrInsufficientStock:
+		default:
+			t.Errorf("unexpected deduction error: %v", err)
+		}
+	}
+	if want := stock / quantity; succeeded != want {
+		t.Errorf("%d deductions succeeded, want %d", succeeded, want)
+	}
+
+	var currentStock int
+	if err := db.Raw("SELECT current_stock FROM medicines WHERE id = ?", medicine.ID).Scan(&currentStock).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := stock - succeeded*quantity; currentStock != want {
+		t.Errorf("current stock is %d, want %d", currentStock, want)
+	}
+
+	var lots []StockLot
+	if err := db.Where("medicine_id = ?", medicine.ID).Find(&lots).Error; err != nil {
+		t.Fatal(err)
+	}
+	lotStock := 0
+	for _, lot := range lots {
+		if lot.Quantity < 0 {
+			t.Errorf("lot %d went below zero to %d", lot.ID, lot.Quantity)
+		}
+		lotStock += lot.Quantity
+	}
+	if lotStock != currentStock {
+		t.Errorf("lots hold %d, current stock is %d", lotStock, currentStock)
+	}
+}
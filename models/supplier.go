@@ -0,0 +1,418 @@
+package models
+
+import (
+	"fmt"
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PurchaseOrderDraft             = "draft"
+	PurchaseOrderOrdered           = "ordered"
+	PurchaseOrderPartiallyReceived = "partially_received"
+	PurchaseOrderReceived          = "received"
+	PurchaseOrderCancelled         = "cancelled"
+)
+
+var (
+	ErrPurchaseOrderState  = fmt.Errorf("Purchase order is not in a state that allows this action")
+	ErrNotInPurchaseOrder  = fmt.Errorf("Medicine is not part of the purchase order")
+	ErrExceedsOutstanding  = fmt.Errorf("Received quantity exceeds the outstanding quantity of the purchase order")
+	ErrEmptyPurchaseOrder  = fmt.Errorf("Purchase order has no lines")
+	ErrDuplicateOrderLines = fmt.Errorf("Medicine appears more than once in the purchase order")
+)
+
+type Supplier struct {
+	ID            int       `json:"id" gorm:"column:id;primaryKey"`
+	Name          string    `json:"name" gorm:"column:name;unique"`
+	ContactPerson string    `json:"contact_person" gorm:"column:contact_person"`
+	Phone         string    `json:"phone" gorm:"column:phone"`
+	Email         string    `json:"email" gorm:"column:email"`
+	Address       string    `json:"address" gorm:"column:address"`
+	GSTIN         string    `json:"gstin" gorm:"column:gstin"`
+	LeadTimeDays  int       `json:"lead_time_days" gorm:"column:lead_time_days;default:0"`
+	CreatedAt     time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+type PurchaseOrder struct {
+	ID         int        `json:"id" gorm:"column:id;primaryKey"`
+	SupplierID int        `json:"supplier_id" gorm:"column:supplier_id"`
+	Status     string     `json:"status" gorm:"column:status;default:draft"`
+	Notes      string     `json:"notes" gorm:"column:notes"`
+	OrderedAt  *time.Time `json:"ordered_at" gorm:"column:ordered_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"column:created_at"`
+
+	Lines    []PurchaseOrderLine `json:"lines" gorm:"foreignKey:PurchaseOrderID;references:ID"`
+	Supplier Supplier            `json:"-" gorm:"foreignKey:SupplierID;references:ID"`
+}
+
+type PurchaseOrderLine struct {
+	ID               int     `json:"id" gorm:"column:id;primaryKey"`
+	PurchaseOrderID  int     `json:"purchase_order_id" gorm:"column:purchase_order_id;uniqueIndex:idx_purchase_order_lines_order_medicine"`
+	MedicineID       int     `json:"medicine_id" gorm:"column:medicine_id;uniqueIndex:idx_purchase_order_lines_order_medicine"`
+	Quantity         int     `json:"quantity" gorm:"column:quantity"`
+	ReceivedQuantity int     `json:"received_quantity" gorm:"column:received_quantity;default:0"`
+	UnitPrice        float64 `json:"unit_price" gorm:"column:unit_price"`
+
+	OutstandingQuantity int `json:"outstanding_quantity" gorm:"-"`
+
+	Medicine      Medicine      `json:"-" gorm:"foreignKey:MedicineID;references:ID"`
+	PurchaseOrder PurchaseOrder `json:"-" gorm:"foreignKey:PurchaseOrderID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (s *Supplier) Create(db *gorm.DB) error {
+	s.ID = 0 //To prevent id from being set by the client
+	err := db.Create(s).Error
+	if err != nil {
+		if err.Error() == "ERROR: duplicate key value violates unique constraint \"uni_suppliers_name\" (SQLSTATE 23505)" {
+			return ErrUniqueNameViolation
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Supplier) Update(db *gorm.DB) error {
+	err := db.Omit("created_at").Save(s).Error
+	if err != nil {
+		if err.Error() == "ERROR: duplicate key value violates unique constraint \"uni_suppliers_name\" (SQLSTATE 23505)" {
+			return ErrUniqueNameViolation
+		}
+		return err
+	}
+	return nil
+}
+
+func GetAllSuppliers(db *gorm.DB) ([]Supplier, error) {
+	var suppliers []Supplier
+	err := db.Order("name").Find(&suppliers).Error
+	return suppliers, err
+}
+
+func GetSupplierByID(db *gorm.DB, id int) (*Supplier, error) {
+	var supplier Supplier
+	err := db.First(&supplier, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &supplier, nil
+}
+
+func DeleteSupplier(db *gorm.DB, id int) error {
+	return db.Delete(&Supplier{}, id).Error
+}
+
+// Create saves a draft purchase order together with its lines.
+func (p *PurchaseOrder) Create(db *gorm.DB) error {
+	if len(p.Lines) == 0 {
+		return ErrEmptyPurchaseOrder
+	}
+	seen := make(map[int]bool)
+	for i := range p.Lines {
+		if seen[p.Lines[i].MedicineID] {
+			return ErrDuplicateOrderLines
+		}
+		seen[p.Lines[i].MedicineID] = true
+	}
+
+	p.ID = 0
+	p.Status = PurchaseOrderDraft
+	return db.Create(p).Error
+}
+
+func GetPurchaseOrderByID(db *gorm.DB, id int) (*PurchaseOrder, error) {
+	var purchaseOrder PurchaseOrder
+	err := db.Preload("Lines").First(&purchaseOrder, id).Error
+	if err != nil {
+		return nil, err
+	}
+	purchaseOrder.fillOutstanding()
+	return &purchaseOrder, nil
+}
+
+func GetAllPurchaseOrders(db *gorm.DB, status string, supplierID, offset, limit int) ([]PurchaseOrder, error) {
+	var purchaseOrders []PurchaseOrder
+	query := db.Preload("Lines")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if supplierID != 0 {
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+	err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&purchaseOrders).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range purchaseOrders {
+		purchaseOrders[i].fillOutstanding()
+	}
+	return purchaseOrders, nil
+}
+
+func (p *PurchaseOrder) fillOutstanding() {
+	for i := range p.Lines {
+		p.Lines[i].OutstandingQuantity = max(p.Lines[i].Quantity-p.Lines[i].ReceivedQuantity, 0)
+	}
+}
+
+// SetPurchaseOrderStatus moves a purchase order to ordered or cancelled.
+func SetPurchaseOrderStatus(db *gorm.DB, id int, status string) error {
+	var allowedFrom []string
+	updates := map[string]interface{}{"status": status}
+	switch status {
+	case PurchaseOrderOrdered:
+		allowedFrom = []string{PurchaseOrderDraft}
+		updates["ordered_at"] = time.Now()
+	case PurchaseOrderCancelled:
+		allowedFrom = []string{PurchaseOrderDraft, PurchaseOrderOrdered}
+	default:
+		return ErrPurchaseOrderState
+	}
+
+	result := db.Model(&PurchaseOrder{}).Where("id = ? AND status IN ?", id, allowedFrom).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPurchaseOrderState
+	}
+	return nil
+}
+
+// ReceivePurchaseOrder adds the received lines to stock as an addition linked to the purchase order
+// and its supplier, and moves the order to partially received or received.
+func ReceivePurchaseOrder(db *gorm.DB, purchaseOrderID int, sReq *StockAdditionRequest) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	// the received quantities are written back as read here, so a concurrent receipt, void or
+	// correction of a receipt must wait for this one
+	purchaseOrder, err := lockPurchaseOrder(tx, purchaseOrderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if purchaseOrder.Status != PurchaseOrderOrdered && purchaseOrder.Status != PurchaseOrderPartiallyReceived {
+		tx.Rollback()
+		return ErrPurchaseOrderState
+	}
+
+	err = convertStockAdditionChanges(tx, sReq.StockChanges)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	locationID, err := resolveLocationID(tx, sReq.LocationID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	lines := make(map[int]*PurchaseOrderLine)
+	for i := range purchaseOrder.Lines {
+		lines[purchaseOrder.Lines[i].MedicineID] = &purchaseOrder.Lines[i]
+	}
+	for i := range sReq.StockChanges {
+		stockChange := &sReq.StockChanges[i]
+		line, ok := lines[stockChange.MedicineID]
+		if !ok {
+			tx.Rollback()
+			return ErrNotInPurchaseOrder
+		}
+		// the ordered price is the cost unless the invoice says otherwise
+		if stockChange.UnitCost == 0 {
+			stockChange.UnitCost = line.UnitPrice
+		}
+		line.ReceivedQuantity += stockChange.Quantity
+		if line.ReceivedQuantity > line.Quantity {
+			tx.Rollback()
+			return ErrExceedsOutstanding
+		}
+	}
+
+	stockUpdation := &StockUpdation{
+		BroughtAt:       time.Now(),
+		IsAddtion:       true,
+		Kind:            MovementPurchase,
+		LocationID:      locationID,
+		SupplierID:      &purchaseOrder.SupplierID,
+		PurchaseOrderID: &purchaseOrder.ID,
+	}
+	err = tx.Create(stockUpdation).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = addStockParticulars(tx, stockUpdation.ID, locationID, sReq.StockChanges)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = recordPurchaseTax(tx, stockUpdation)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i := range purchaseOrder.Lines {
+		err = tx.Model(&PurchaseOrderLine{}).Where("id = ?", purchaseOrder.Lines[i].ID).Update("received_quantity", purchaseOrder.Lines[i].ReceivedQuantity).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = refreshPurchaseOrderStatus(tx, purchaseOrder.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// lockPurchaseOrder locks the purchase order and its lines. Receiving, voiding and correcting a receipt
+// all lock the order before the medicines, so that they wait for each other instead of deadlocking.
+func lockPurchaseOrder(tx *gorm.DB, purchaseOrderID int) (*PurchaseOrder, error) {
+	var purchaseOrder PurchaseOrder
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&purchaseOrder, purchaseOrderID).Error
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("purchase_order_id = ?", purchaseOrderID).Order("id").Find(&purchaseOrder.Lines).Error
+	if err != nil {
+		return nil, err
+	}
+	return &purchaseOrder, nil
+}
+
+// adjustPurchaseOrderReceipt adds (sign 1) or removes (sign -1) received quantities on the purchase order,
+// used when a receipt is voided or corrected.
+func adjustPurchaseOrderReceipt(tx *gorm.DB, purchaseOrderID int, particulars []StockUpdationParticulars, sign int) error {
+	for i := range particulars {
+		result := tx.Model(&PurchaseOrderLine{}).
+			Where("purchase_order_id = ? AND medicine_id = ?", purchaseOrderID, particulars[i].MedicineID).
+			Where("received_quantity + ? BETWEEN 0 AND quantity", sign*particulars[i].Quantity).
+			Update("received_quantity", gorm.Expr("received_quantity + ?", sign*particulars[i].Quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if sign > 0 {
+				return ErrExceedsOutstanding
+			}
+			return ErrNotInPurchaseOrder
+		}
+	}
+
+	return refreshPurchaseOrderStatus(tx, purchaseOrderID)
+}
+
+// refreshPurchaseOrderStatus sets the receiving status of an order from the received quantities of its lines.
+func refreshPurchaseOrderStatus(tx *gorm.DB, purchaseOrderID int) error {
+	var lines []PurchaseOrderLine
+	err := tx.Where("purchase_order_id = ?", purchaseOrderID).Find(&lines).Error
+	if err != nil {
+		return err
+	}
+
+	status := PurchaseOrderOrdered
+	fullyReceived := true
+	for i := range lines {
+		if lines[i].ReceivedQuantity > 0 {
+			status = PurchaseOrderPartiallyReceived
+		}
+		if lines[i].ReceivedQuantity < lines[i].Quantity {
+			fullyReceived = false
+		}
+	}
+	if fullyReceived {
+		status = PurchaseOrderReceived
+	}
+
+	return tx.Model(&PurchaseOrder{}).Where("id = ? AND status <> ?", purchaseOrderID, PurchaseOrderCancelled).Update("status", status).Error
+}
+
+// CreatePurchaseOrdersFromReorderBill turns the reorder bill into one draft purchase order per preferred supplier.
+// Medicines without a preferred supplier are returned as skipped.
+func CreatePurchaseOrdersFromReorderBill(db *gorm.DB, level string) (*response.DraftPurchaseOrders, error) {
+	bill, err := GetReorderBill(db, level)
+	if err != nil {
+		return nil, err
+	}
+
+	medicineIDs := []int{}
+	for _, group := range bill.Groups {
+		for _, item := range group.Items {
+			if item.QuantityToBuy > 0 {
+				medicineIDs = append(medicineIDs, item.MedicineID)
+			}
+		}
+	}
+
+	var medicines []Medicine
+	err = db.Where("id IN ?", medicineIDs).Find(&medicines).Error
+	if err != nil {
+		return nil, err
+	}
+	preferredSuppliers := make(map[int]*int)
+	for i := range medicines {
+		preferredSuppliers[medicines[i].ID] = medicines[i].PreferredSupplierID
+	}
+
+	result := &response.DraftPurchaseOrders{
+		PurchaseOrderIDs: []int{},
+		Skipped:          []response.StockSummary{},
+	}
+	supplierOrder := []int{}
+	orders := make(map[int]*PurchaseOrder)
+	for _, group := range bill.Groups {
+		for _, item := range group.Items {
+			if item.QuantityToBuy <= 0 {
+				continue
+			}
+			supplierID := preferredSuppliers[item.MedicineID]
+			if supplierID == nil {
+				result.Skipped = append(result.Skipped, item)
+				continue
+			}
+			if _, ok := orders[*supplierID]; !ok {
+				orders[*supplierID] = &PurchaseOrder{
+					SupplierID: *supplierID,
+					Status:     PurchaseOrderDraft,
+					Notes:      "Generated from reorder bill",
+				}
+				supplierOrder = append(supplierOrder, *supplierID)
+			}
+			orders[*supplierID].Lines = append(orders[*supplierID].Lines, PurchaseOrderLine{
+				MedicineID: item.MedicineID,
+				Quantity:   item.QuantityToBuy,
+				UnitPrice:  item.UnitPrice,
+			})
+		}
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	for _, supplierID := range supplierOrder {
+		err = tx.Create(orders[supplierID]).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		result.PurchaseOrderIDs = append(result.PurchaseOrderIDs, orders[supplierID].ID)
+	}
+
+	return result, tx.Commit().Error
+}
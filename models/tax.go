@@ -0,0 +1,249 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GSTRates are the GST slabs a medicine or medicine type can be taxed at, in percent.
+var GSTRates = []float64{0, 0.25, 3, 5, 12, 18, 28}
+
+// StoreGSTIN is the GSTIN of the store, set at startup. A purchase from a supplier registered in
+// another state is taxed as IGST instead of CGST and SGST.
+var StoreGSTIN string
+
+var ErrInvalidTaxRate = fmt.Errorf("Tax rate is not a GST slab")
+
+// PurchaseTaxLine is the GST paid on a medicine in a purchase receipt, the input tax.
+// The taxable amount is the purchase cost of the quantity received.
+type PurchaseTaxLine struct {
+	StockUpdationID int     `json:"stock_updation_id" gorm:"column:stock_updation_id;primaryKey"`
+	MedicineID      int     `json:"medicine_id" gorm:"column:medicine_id;primaryKey"`
+	HSNCode         string  `json:"hsn_code" gorm:"column:hsn_code"`
+	TaxableAmount   float64 `json:"taxable_amount" gorm:"column:taxable_amount"`
+	TaxRate         float64 `json:"tax_rate" gorm:"column:tax_rate"`
+	CGSTAmount      float64 `json:"cgst_amount" gorm:"column:cgst_amount"`
+	SGSTAmount      float64 `json:"sgst_amount" gorm:"column:sgst_amount"`
+	IGSTAmount      float64 `json:"igst_amount" gorm:"column:igst_amount"`
+
+	StockUpdation StockUpdation `json:"-" gorm:"foreignKey:StockUpdationID;references:ID;constraint:OnDelete:CASCADE"`
+}
+
+func checkTaxRate(rate *float64) error {
+	if rate == nil {
+		return nil
+	}
+	for _, slab := range GSTRates {
+		if *rate == slab {
+			return nil
+		}
+	}
+	return ErrInvalidTaxRate
+}
+
+// splitGST works out the tax on the taxable amount, as IGST for an inter-state supply
+// and otherwise halved into CGST and SGST.
+func splitGST(taxable, rate float64, interState bool) (cgst, sgst, igst float64) {
+	tax := roundAmount(taxable * rate / 100)
+	if interState {
+		return 0, 0, tax
+	}
+	cgst, sgst = halveTax(tax)
+	return cgst, sgst, 0
+}
+
+// halveTax splits the tax into CGST and SGST, the odd paisa going to SGST.
+func halveTax(tax float64) (cgst, sgst float64) {
+	paise := math.Round(tax * 100)
+	half := math.Floor(paise / 2)
+	return half / 100, (paise - half) / 100
+}
+
+// splitInclusiveGST takes the GST out of an amount that includes it, as selling prices do like the MRP,
+// returning the taxable value and the tax split as splitGST does.
+func splitInclusiveGST(amount, rate float64, interState bool) (taxable, cgst, sgst, igst float64) {
+	taxable = roundAmount(amount * 100 / (100 + rate))
+	tax := roundAmount(amount - taxable)
+	if interState {
+		return taxable, 0, 0, tax
+	}
+	cgst, sgst = halveTax(tax)
+	return taxable, cgst, sgst, 0
+}
+
+// isInterStateSupplier compares the state codes, the first two digits, of the supplier's and the store's GSTIN.
+// It is intra-state when either is not known.
+func isInterStateSupplier(tx *gorm.DB, supplierID *int) (bool, error) {
+	if supplierID == nil || len(StoreGSTIN) < 2 {
+		return false, nil
+	}
+	var supplier Supplier
+	err := tx.Select("gstin").First(&supplier, *supplierID).Error
+	if err != nil {
+		return false, err
+	}
+	if len(supplier.GSTIN) < 2 {
+		return false, nil
+	}
+	return supplier.GSTIN[:2] != StoreGSTIN[:2], nil
+}
+
+// medicineTaxSQL selects the HSN code and tax rate of a medicine m, falling back to its type mt.
+const medicineTaxSQL = `
+	COALESCE(NULLIF(m.hsn_code, ''), mt.hsn_code, '') AS hsn_code,
+	COALESCE(m.tax_rate, mt.tax_rate, 0) AS tax_rate`
+
+// recordPurchaseTax records the input tax of a purchase receipt at the medicines' tax rates,
+// on the cost of the lots it added. Other stock additions carry no tax.
+func recordPurchaseTax(tx *gorm.DB, stockUpdation *StockUpdation) error {
+	if !stockUpdation.IsAddtion || stockUpdation.Kind != MovementPurchase {
+		return nil
+	}
+	interState, err := isInterStateSupplier(tx, stockUpdation.SupplierID)
+	if err != nil {
+		return err
+	}
+
+	var lines []PurchaseTaxLine
+	query := `
+		SELECT
+			sul.medicine_id,
+			` + medicineTaxSQL + `,
+			SUM(sul.quantity * sul.unit_cost) AS taxable_amount
+		FROM
+			stock_updation_lots sul
+		JOIN
+			medicines m
+		ON
+			sul.medicine_id = m.id
+		LEFT JOIN
+			med_types mt
+		ON
+			m.type_id = mt.id
+		WHERE
+			sul.stock_updation_id = ?
+		GROUP BY
+			sul.medicine_id, m.hsn_code, m.tax_rate, mt.hsn_code, mt.tax_rate
+	`
+	err = tx.Raw(query, stockUpdation.ID).Scan(&lines).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range lines {
+		lines[i].StockUpdationID = stockUpdation.ID
+		lines[i].TaxableAmount = roundAmount(lines[i].TaxableAmount)
+		lines[i].CGSTAmount, lines[i].SGSTAmount, lines[i].IGSTAmount = splitGST(lines[i].TaxableAmount, lines[i].TaxRate, interState)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return tx.Create(&lines).Error
+}
+
+// GetTaxSummary totals the output tax of issued invoices and the input tax of purchase receipts in the
+// month, by tax rate. An invoice cancelled or a receipt voided in the month counts against the month's
+// tax, so the months already reported stay as they were.
+func GetTaxSummary(db *gorm.DB, month time.Time) (*response.TaxSummary, error) {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	until := from.AddDate(0, 1, 0)
+
+	var output []response.TaxRateSummary
+	query := `
+		SELECT
+			il.tax_rate,
+			SUM(t.sign * il.taxable_amount) AS taxable_amount,
+			SUM(t.sign * il.cgst_amount) AS cgst_amount,
+			SUM(t.sign * il.sgst_amount) AS sgst_amount,
+			SUM(t.sign * il.igst_amount) AS igst_amount
+		FROM (
+			SELECT id, 1 AS sign FROM invoices WHERE issued_at >= ? AND issued_at < ?
+			UNION ALL
+			SELECT id, -1 AS sign FROM invoices WHERE issued_at IS NOT NULL AND cancelled_at >= ? AND cancelled_at < ?
+		) t
+		JOIN
+			invoice_lines il
+		ON
+			il.invoice_id = t.id
+		GROUP BY
+			il.tax_rate
+	`
+	err := db.Raw(query, from, until, from, until).Scan(&output).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var input []response.TaxRateSummary
+	query = `
+		SELECT
+			ptl.tax_rate,
+			SUM(CASE WHEN su.entry_type = ? THEN -1 ELSE 1 END * ptl.taxable_amount) AS taxable_amount,
+			SUM(CASE WHEN su.entry_type = ? THEN -1 ELSE 1 END * ptl.cgst_amount) AS cgst_amount,
+			SUM(CASE WHEN su.entry_type = ? THEN -1 ELSE 1 END * ptl.sgst_amount) AS sgst_amount,
+			SUM(CASE WHEN su.entry_type = ? THEN -1 ELSE 1 END * ptl.igst_amount) AS igst_amount
+		FROM
+			stock_updations su
+		JOIN
+			purchase_tax_lines ptl
+		ON
+			ptl.stock_updation_id = CASE WHEN su.entry_type = ? THEN su.reference_id ELSE su.id END
+		WHERE
+			su.is_addition
+			AND su.kind = ?
+			AND su.brought_at >= ?
+			AND su.brought_at < ?
+		GROUP BY
+			ptl.tax_rate
+	`
+	err = db.Raw(query, EntryTypeReversal, EntryTypeReversal, EntryTypeReversal, EntryTypeReversal, EntryTypeReversal,
+		MovementPurchase, from, until).Scan(&input).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make(map[float64]*response.TaxSlabSummary)
+	slab := func(rate float64) *response.TaxSlabSummary {
+		if _, ok := rates[rate]; !ok {
+			rates[rate] = &response.TaxSlabSummary{TaxRate: rate}
+		}
+		return rates[rate]
+	}
+	for _, line := range output {
+		line.TotalTax = roundAmount(line.CGSTAmount + line.SGSTAmount + line.IGSTAmount)
+		slab(line.TaxRate).Output = line
+	}
+	for _, line := range input {
+		line.TotalTax = roundAmount(line.CGSTAmount + line.SGSTAmount + line.IGSTAmount)
+		slab(line.TaxRate).Input = line
+	}
+
+	summary := &response.TaxSummary{
+		Month: from.Format("2006-01"),
+		Rates: []response.TaxSlabSummary{},
+	}
+	for _, rate := range GSTRates {
+		if slab, ok := rates[rate]; ok {
+			slab.NetTax = roundAmount(slab.Output.TotalTax - slab.Input.TotalTax)
+			summary.Rates = append(summary.Rates, *slab)
+			summary.OutputTax += slab.Output.TotalTax
+			summary.InputTax += slab.Input.TotalTax
+			delete(rates, rate)
+		}
+	}
+	// rates no longer a slab, from medicines taxed before a slab changed
+	for _, slab := range rates {
+		slab.NetTax = roundAmount(slab.Output.TotalTax - slab.Input.TotalTax)
+		summary.Rates = append(summary.Rates, *slab)
+		summary.OutputTax += slab.Output.TotalTax
+		summary.InputTax += slab.Input.TotalTax
+	}
+	summary.OutputTax = roundAmount(summary.OutputTax)
+	summary.InputTax = roundAmount(summary.InputTax)
+	summary.NetTax = roundAmount(summary.OutputTax - summary.InputTax)
+
+	return summary, nil
+}
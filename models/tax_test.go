@@ -0,0 +1,111 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+// paise turns an amount into whole paise, so that sums can be compared exactly.
+func paise(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// testAmounts are line amounts that leave odd paise and sub-paisa remainders at the GST slabs.
+var testAmounts = []float64{0, 0.01, 0.05, 0.99, 1, 1.13, 7.12, 10, 28.35, 99.99, 100, 112, 118.01, 1234.57, 99999.99}
+
+func TestSplitInclusiveGST(t *testing.T) {
+	for _, rate := range GSTRates {
+		for _, amount := range testAmounts {
+			for _, interState := range []bool{false, true} {
+				taxable, cgst, sgst, igst := splitInclusiveGST(amount, rate, interState)
+
+				if got := paise(taxable) + paise(cgst) + paise(sgst) + paise(igst); got != paise(amount) {
+					t.Errorf("rate %v, amount %v, inter-state %t: taxable %v + CGST %v + SGST %v + IGST %v = %d paise, want %d",
+						rate, amount, interState, taxable, cgst, sgst, igst, got, paise(amount))
+				}
+				if want := amount * 100 / (100 + rate); math.Abs(taxable-want) > 0.005+1e-9 {
+					t.Errorf("rate %v, amount %v: taxable %v, want %v to the paisa", rate, amount, taxable, want)
+				}
+				for _, part := range []float64{taxable, cgst, sgst, igst} {
+					if part < 0 || float64(paise(part))/100 != part {
+						t.Errorf("rate %v, amount %v: %v is negative or not in whole paise", rate, amount, part)
+					}
+				}
+
+				if interState {
+					if cgst != 0 || sgst != 0 {
+						t.Errorf("rate %v, amount %v: inter-state supply charged CGST %v and SGST %v", rate, amount, cgst, sgst)
+					}
+					continue
+				}
+				if igst != 0 {
+					t.Errorf("rate %v, amount %v: intra-state supply charged IGST %v", rate, amount, igst)
+				}
+				// an odd paisa goes to SGST
+				if diff := paise(sgst) - paise(cgst); diff != 0 && diff != 1 {
+					t.Errorf("rate %v, amount %v: CGST %v and SGST %v, want equal halves or the odd paisa on SGST", rate, amount, cgst, sgst)
+				}
+			}
+		}
+	}
+}
+
+func TestSplitInclusiveGSTOddPaisa(t *testing.T) {
+	// 1.05 at 5% leaves 0.05 of tax and 0.03 at 28% leaves 0.01, so SGST takes the odd paisa
+	tests := []struct {
+		amount, rate        float64
+		taxable, cgst, sgst float64
+	}{
+		{1.13, 12, 1.01, 0.06, 0.06},
+		{1.05, 5, 1, 0.02, 0.03},
+		{118.01, 18, 100.01, 9, 9},
+		{0.01, 28, 0.01, 0, 0},
+		{0.03, 28, 0.02, 0, 0.01},
+	}
+	for _, tt := range tests {
+		taxable, cgst, sgst, igst := splitInclusiveGST(tt.amount, tt.rate, false)
+		if taxable != tt.taxable || cgst != tt.cgst || sgst != tt.sgst || igst != 0 {
+			t.Errorf("splitInclusiveGST(%v, %v) = %v, %v, %v, %v, want %v, %v, %v, 0",
+				tt.amount, tt.rate, taxable, cgst, sgst, igst, tt.taxable, tt.cgst, tt.sgst)
+		}
+	}
+}
+
+func TestSplitGST(t *testing.T) {
+	for _, rate := range GSTRates {
+		for _, taxable := range testAmounts {
+			tax := paise(taxable * rate / 100)
+
+			cgst, sgst, igst := splitGST(taxable, rate, false)
+			if got := paise(cgst) + paise(sgst); got != tax || igst != 0 {
+				t.Errorf("rate %v, taxable %v: CGST %v + SGST %v = %d paise and IGST %v, want %d paise and no IGST", rate, taxable, cgst, sgst, got, igst, tax)
+			}
+			if diff := paise(sgst) - paise(cgst); diff != 0 && diff != 1 {
+				t.Errorf("rate %v, taxable %v: CGST %v and SGST %v, want equal halves or the odd paisa on SGST", rate, taxable, cgst, sgst)
+			}
+
+			cgst, sgst, igst = splitGST(taxable, rate, true)
+			if paise(igst) != tax || cgst != 0 || sgst != 0 {
+				t.Errorf("rate %v, taxable %v inter-state: CGST %v, SGST %v, IGST %v, want only IGST of %d paise", rate, taxable, cgst, sgst, igst, tax)
+			}
+		}
+	}
+}
+
+func TestCheckTaxRate(t *testing.T) {
+	for _, rate := range GSTRates {
+		rate := rate
+		if err := checkTaxRate(&rate); err != nil {
+			t.Errorf("checkTaxRate(%v) = %v, want nil", rate, err)
+		}
+	}
+	if err := checkTaxRate(nil); err != nil {
+		t.Errorf("checkTaxRate(nil) = %v, want nil", err)
+	}
+	for _, rate := range []float64{-5, 1, 6, 12.5, 40} {
+		rate := rate
+		if err := checkTaxRate(&rate); err != ErrInvalidTaxRate {
+			t.Errorf("checkTaxRate(%v) = %v, want %v", rate, err, ErrInvalidTaxRate)
+		}
+	}
+}
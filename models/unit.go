@@ -0,0 +1,155 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownUnit  = fmt.Errorf("Unit is not defined for the medicine")
+	ErrInvalidUnits = fmt.Errorf("Unit names must be unique and differ from the base unit")
+)
+
+// MedicineUnit is a pack of a medicine, like a strip or a box, holding Factor base units.
+// A box of 10 strips of 15 tablets is a strip with factor 15 and a box with factor 150.
+type MedicineUnit struct {
+	ID         int    `json:"id" gorm:"column:id;primaryKey"`
+	MedicineID int    `json:"medicine_id" gorm:"column:medicine_id;uniqueIndex:idx_medicine_units_medicine_name"`
+	Name       string `json:"name" gorm:"column:name;uniqueIndex:idx_medicine_units_medicine_name"`
+	Factor     int    `json:"factor" gorm:"column:factor;check:chk_medicine_units_factor,factor > 1"`
+}
+
+func (u *MedicineUnit) TableName() string {
+	return "medicine_units"
+}
+
+const DefaultBaseUnit = "unit"
+
+// normaliseUnits defaults the base unit and makes sure every pack of the medicine
+// can be told apart from the others and from the base unit.
+func (m *Medicine) normaliseUnits() error {
+	if m.BaseUnit == "" {
+		m.BaseUnit = DefaultBaseUnit
+	}
+	names := map[string]bool{strings.ToLower(m.BaseUnit): true}
+	for _, unit := range m.Units {
+		name := strings.ToLower(unit.Name)
+		if names[name] {
+			return ErrInvalidUnits
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// setStockInPacks fills StockInPacks from the current stock and the loaded units.
+func (m *Medicine) setStockInPacks() {
+	m.StockInPacks = FormatPacks(m.CurrentStock, m.BaseUnit, m.Units)
+}
+
+// FormatPacks splits a quantity in base units into the largest packs first, e.g. "2 box, 3 strip, 5 tablet".
+func FormatPacks(quantity int, baseUnit string, units []MedicineUnit) string {
+	packs := make([]MedicineUnit, len(units))
+	copy(packs, units)
+	sort.Slice(packs, func(i, j int) bool { return packs[i].Factor > packs[j].Factor })
+
+	parts := []string{}
+	remaining := quantity
+	for _, pack := range packs {
+		if pack.Factor <= 1 || remaining < pack.Factor {
+			continue
+		}
+		parts = append(parts, strconv.Itoa(remaining/pack.Factor)+" "+pack.Name)
+		remaining %= pack.Factor
+	}
+	if remaining > 0 || len(parts) == 0 {
+		parts = append(parts, strconv.Itoa(remaining)+" "+baseUnit)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func getUnitsByMedicineIDs(db *gorm.DB, medicineIDs []int) (map[int][]MedicineUnit, error) {
+	unitsByMedicine := make(map[int][]MedicineUnit)
+	if len(medicineIDs) == 0 {
+		return unitsByMedicine, nil
+	}
+
+	var units []MedicineUnit
+	err := db.Where("medicine_id IN ?", medicineIDs).Order("factor").Find(&units).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, unit := range units {
+		unitsByMedicine[unit.MedicineID] = append(unitsByMedicine[unit.MedicineID], unit)
+	}
+	return unitsByMedicine, nil
+}
+
+// unitConverter resolves the factor of a medicine's unit, remembering what it has looked up.
+type unitConverter struct {
+	tx      *gorm.DB
+	factors map[int]map[string]int
+}
+
+func newUnitConverter(tx *gorm.DB) *unitConverter {
+	return &unitConverter{tx: tx, factors: make(map[int]map[string]int)}
+}
+
+// toBaseUnits converts the quantity of a stock change to base units. An empty unit or
+// the medicine's base unit is already in base units. The unit is cleared once converted.
+func (uc *unitConverter) toBaseUnits(change *StockChanges) error {
+	if change.Unit == "" {
+		return nil
+	}
+
+	factors, ok := uc.factors[change.MedicineID]
+	if !ok {
+		var medicine Medicine
+		err := uc.tx.Preload("Units").Select("id", "base_unit").Where("id = ?", change.MedicineID).First(&medicine).Error
+		if err != nil {
+			return err
+		}
+		factors = map[string]int{strings.ToLower(medicine.BaseUnit): 1}
+		for _, unit := range medicine.Units {
+			factors[strings.ToLower(unit.Name)] = unit.Factor
+		}
+		uc.factors[change.MedicineID] = factors
+	}
+
+	factor, ok := factors[strings.ToLower(change.Unit)]
+	if !ok {
+		return ErrUnknownUnit
+	}
+	change.Quantity *= factor
+	change.Unit = ""
+	return nil
+}
+
+func convertStockChanges(tx *gorm.DB, stockChanges []StockChanges) error {
+	uc := newUnitConverter(tx)
+	for i := range stockChanges {
+		if err := uc.toBaseUnits(&stockChanges[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertStockAdditionChanges converts the quantities to base units, and the unit costs with them.
+func convertStockAdditionChanges(tx *gorm.DB, stockChanges []StockAdditionChanges) error {
+	uc := newUnitConverter(tx)
+	for i := range stockChanges {
+		quantity := stockChanges[i].Quantity
+		if err := uc.toBaseUnits(&stockChanges[i].StockChanges); err != nil {
+			return err
+		}
+		if stockChanges[i].Quantity != quantity {
+			stockChanges[i].UnitCost = stockChanges[i].UnitCost * float64(quantity) / float64(stockChanges[i].Quantity)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package models
+
+import "testing"
+
+func TestFormatPacks(t *testing.T) {
+	strip := MedicineUnit{Name: "strip", Factor: 15}
+	box := MedicineUnit{Name: "box", Factor: 150}
+
+	tests := []struct {
+		name     string
+		quantity int
+		units    []MedicineUnit
+		want     string
+	}{
+		{"no packs", 40, nil, "40 tablet"},
+		{"zero with no packs", 0, nil, "0 tablet"},
+		{"zero with packs", 0, []MedicineUnit{strip, box}, "0 tablet"},
+		{"less than a pack", 7, []MedicineUnit{strip, box}, "7 tablet"},
+		{"exact pack", 15, []MedicineUnit{strip}, "1 strip"},
+		{"largest packs first", 335, []MedicineUnit{strip, box}, "2 box, 2 strip, 5 tablet"},
+		{"packs given largest first", 335, []MedicineUnit{box, strip}, "2 box, 2 strip, 5 tablet"},
+		{"skips a pack not needed", 305, []MedicineUnit{strip, box}, "2 box, 5 tablet"},
+		{"exact boxes", 300, []MedicineUnit{strip, box}, "2 box"},
+		{"factor of one is ignored", 4, []MedicineUnit{{Name: "single", Factor: 1}}, "4 tablet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatPacks(tt.quantity, "tablet", tt.units); got != tt.want {
+				t.Errorf("FormatPacks(%d) = %q, want %q", tt.quantity, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatPacksKeepsUnitsOrder(t *testing.T) {
+	units := []MedicineUnit{{Name: "strip", Factor: 15}, {Name: "box", Factor: 150}}
+	FormatPacks(200, "tablet", units)
+	if units[0].Name != "strip" || units[1].Name != "box" {
+		t.Errorf("FormatPacks reordered the units passed in: %v", units)
+	}
+}
+
+func TestToBaseUnits(t *testing.T) {
+	// the factors are cached, so the converter does not go to the database
+	uc := newUnitConverter(nil)
+	uc.factors[1] = map[string]int{"tablet": 1, "strip": 15, "box": 150}
+
+	tests := []struct {
+		name     string
+		change   StockChanges
+		want     int
+		wantErr  error
+		wantUnit string
+	}{
+		{"no unit is base units", StockChanges{MedicineID: 1, Quantity: 7}, 7, nil, ""},
+		{"base unit", StockChanges{MedicineID: 1, Quantity: 7, Unit: "tablet"}, 7, nil, ""},
+		{"pack", StockChanges{MedicineID: 1, Quantity: 2, Unit: "strip"}, 30, nil, ""},
+		{"larger pack", StockChanges{MedicineID: 1, Quantity: 3, Unit: "box"}, 450, nil, ""},
+		{"unit name ignores case", StockChanges{MedicineID: 1, Quantity: 2, Unit: "Strip"}, 30, nil, ""},
+		{"unknown unit", StockChanges{MedicineID: 1, Quantity: 2, Unit: "bottle"}, 2, ErrUnknownUnit, "bottle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change := tt.change
+			err := uc.toBaseUnits(&change)
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if change.Quantity != tt.want {
+				t.Errorf("quantity = %d, want %d", change.Quantity, tt.want)
+			}
+			if change.Unit != tt.wantUnit {
+				t.Errorf("unit = %q, want %q", change.Unit, tt.wantUnit)
+			}
+		})
+	}
+}
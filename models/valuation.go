@@ -0,0 +1,156 @@
+package models
+
+import (
+	"med-manager/domain/response"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// costLayer is a quantity of a medicine that came into stock at one unit cost.
+type costLayer struct {
+	MedicineID int     `gorm:"column:medicine_id"`
+	Quantity   int     `gorm:"column:quantity"`
+	UnitCost   float64 `gorm:"column:unit_cost"`
+}
+
+// GetStockValuation values the stock on hand at the end of the asOf day. The quantity is the ledger
+// balance on that day. Every addition still standing then is a cost layer, except transfers in,
+// which only move stock already costed. FIFO values the quantity at the newest layers, as the
+// oldest are taken to have been sold first; weighted average values it at the mean layer cost.
+func GetStockValuation(db *gorm.DB, asOf time.Time) (*response.StockValuation, error) {
+	until := asOf.AddDate(0, 0, 1)
+	valuation := &response.StockValuation{
+		AsOf:      asOf,
+		Medicines: []response.StockValuationLine{},
+	}
+
+	query := `
+		SELECT
+			m.id AS medicine_id,
+			m.name AS medicine,
+			m.base_unit,
+			SUM(` + signedQuantitySQL + `) AS quantity
+		FROM
+			stock_updation_particulars sup
+		JOIN
+			stock_updations su
+		ON
+			sup.stock_updation_id = su.id
+		JOIN
+			medicines m
+		ON
+			sup.medicine_id = m.id
+		WHERE
+			su.brought_at < ?
+		GROUP BY
+			m.id, m.name, m.base_unit
+		HAVING
+			SUM(` + signedQuantitySQL + `) > 0
+		ORDER BY
+			m.name
+	`
+	err := db.Raw(query, until).Scan(&valuation.Medicines).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var layers []costLayer
+	query = `
+		SELECT
+			sul.medicine_id,
+			sul.quantity,
+			sul.unit_cost
+		FROM
+			stock_updation_lots sul
+		JOIN
+			stock_updations su
+		ON
+			sul.stock_updation_id = su.id
+		WHERE
+			su.is_addition
+			AND su.entry_type <> ?
+			AND su.kind <> ?
+			AND su.brought_at < ?
+			AND (su.voided_at IS NULL OR su.voided_at >= ?)
+		ORDER BY
+			su.brought_at DESC, su.id DESC
+	`
+	err = db.Raw(query, EntryTypeReversal, MovementTransferIn, until, until).Scan(&layers).Error
+	if err != nil {
+		return nil, err
+	}
+	layersByMedicine := make(map[int][]costLayer)
+	for _, layer := range layers {
+		layersByMedicine[layer.MedicineID] = append(layersByMedicine[layer.MedicineID], layer)
+	}
+
+	for i := range valuation.Medicines {
+		line := &valuation.Medicines[i]
+		remaining := line.Quantity
+		costedQuantity, costedValue := 0, 0.0
+		for _, layer := range layersByMedicine[line.MedicineID] {
+			if layer.UnitCost > 0 {
+				costedQuantity += layer.Quantity
+				costedValue += float64(layer.Quantity) * layer.UnitCost
+			}
+			if remaining == 0 {
+				continue
+			}
+			taken := min(remaining, layer.Quantity)
+			remaining -= taken
+			if layer.UnitCost > 0 {
+				line.FIFOValue += float64(taken) * layer.UnitCost
+			} else {
+				line.UncostedQuantity += taken
+			}
+		}
+		// stock older than its recorded additions, like balances carried over from before lots
+		line.UncostedQuantity += remaining
+
+		if costedQuantity > 0 {
+			line.WeightedAverageCost = costedValue / float64(costedQuantity)
+			line.WeightedAverageValue = line.WeightedAverageCost * float64(line.Quantity-line.UncostedQuantity)
+		}
+
+		valuation.FIFOValue += line.FIFOValue
+		valuation.WeightedAverageValue += line.WeightedAverageValue
+		valuation.UncostedQuantity += line.UncostedQuantity
+	}
+
+	return valuation, nil
+}
+
+// GetCostOfGoodsSold totals the cost of the lots drawn by sales between from and to (both optional,
+// to is inclusive), at each lot's cost when drawn. Reversed sales give their cost back.
+func GetCostOfGoodsSold(db *gorm.DB, from, to *time.Time) (*response.CostOfGoodsSold, error) {
+	cogs := &response.CostOfGoodsSold{
+		From:      from,
+		To:        to,
+		Medicines: []response.CostOfGoodsSoldLine{},
+	}
+
+	query := db.Table("stock_updation_lots sul").
+		Select(`m.id AS medicine_id,
+			m.name AS medicine,
+			SUM(CASE WHEN su.entry_type = ? THEN -sul.quantity ELSE sul.quantity END) AS quantity,
+			SUM(CASE WHEN su.entry_type = ? THEN -sul.quantity ELSE sul.quantity END * sul.unit_cost) AS cost`, EntryTypeReversal, EntryTypeReversal).
+		Joins("JOIN stock_updations su ON sul.stock_updation_id = su.id").
+		Joins("JOIN medicines m ON sul.medicine_id = m.id").
+		Where("NOT su.is_addition AND su.kind = ?", MovementSale)
+	if from != nil {
+		query = query.Where("su.brought_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("su.brought_at < ?", to.AddDate(0, 0, 1))
+	}
+	err := query.Group("m.id, m.name").Order("m.name").Scan(&cogs.Medicines).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range cogs.Medicines {
+		cogs.TotalCost += line.Cost
+	}
+	return cogs, nil
+}
@@ -19,6 +19,8 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 		medicines.Get("/:id", medicineController.GetMedicine)
 		medicines.Put("/:id", medicineController.UpdateMedicine)
 		medicines.Delete("/:id", medicineController.DeleteMedicine)
+		medicines.Get("/:id/prices", medicineController.GetMedicinePriceHistory)
+		medicines.Post("/:id/prices", medicineController.AddMedicinePrice)
 	}
 
 	// Medicine type routes
@@ -33,6 +35,7 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 
 	// Stock routes
 	stockController := controllers.NewStockController(db)
+	locationController := controllers.NewLocationController(db)
 	stock := app.Group("/stock")
 	{
 		stock.Post("/add", stockController.AddToStock)
@@ -48,29 +51,135 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 		stock.Get("/medicine/:medicine_id", stockController.GetMedicineStockByMedicineID)
 		stock.Get("/medicine/additions/:medicine_id", stockController.GetStockAdditionsByMedicineID)
 		stock.Get("/medicine/deductions/:medicine_id", stockController.GetStockDeductionsByMedicineID)
+		stock.Get("/medicine/lots/:medicine_id", stockController.GetStockLotsByMedicineID)
+		stock.Get("/medicine/card/:medicine_id", stockController.GetStockCard)
+
+		stock.Get("/movements/summary", stockController.GetMovementSummary)
+		stock.Get("/reorder", stockController.GetReorderBill)
+		stock.Get("/reorder/levels", stockController.GetReorderLevelSuggestions)
+		stock.Post("/reorder/levels/apply", stockController.ApplyReorderLevels)
+		stock.Get("/valuation", stockController.GetStockValuation)
+		stock.Get("/cogs", stockController.GetCostOfGoodsSold)
+		stock.Get("/expiring", stockController.GetExpiringStock)
+		stock.Get("/expired", stockController.GetExpiredStock)
+
+		stock.Post("/takes", stockController.StartStockTake)
+		stock.Get("/takes", stockController.GetAllStockTakes)
+		stock.Get("/takes/:id", stockController.GetStockTake)
+		stock.Post("/takes/:id/counts", stockController.SubmitStockTakeCounts)
+		stock.Post("/takes/:id/finalise", stockController.FinaliseStockTake)
+		stock.Post("/takes/:id/cancel", stockController.CancelStockTake)
+
+		stock.Post("/transfers", locationController.TransferStock)
+		stock.Get("/transfers", locationController.GetAllStockTransfers)
+		stock.Get("/transfers/:id", locationController.GetStockTransfer)
 
 	}
 
+	// Location routes
+	locations := app.Group("/locations")
+	{
+		locations.Post("/", locationController.CreateLocation)
+		locations.Get("/", locationController.GetAllLocations)
+		locations.Get("/:id", locationController.GetLocation)
+		locations.Put("/:id", locationController.UpdateLocation)
+		locations.Get("/:id/stock", locationController.GetLocationStock)
+	}
+
+	// Alert routes
+	alertController := controllers.NewAlertController(db)
+	alerts := app.Group("/alerts")
+	{
+		alerts.Get("/", alertController.GetAlerts)
+		alerts.Post("/:id/acknowledge", alertController.AcknowledgeAlert)
+	}
+
+	// Admin routes
+	admin := app.Group("/admin")
+	{
+		admin.Get("/stock/consistency", stockController.CheckStockConsistency)
+		admin.Post("/stock/consistency/repair", stockController.RepairStockConsistency)
+		admin.Get("/stock/audits", stockController.GetStockAudits)
+	}
+
+	// Supplier routes
+	supplierController := controllers.NewSupplierController(db)
+	suppliers := app.Group("/suppliers")
+	{
+		suppliers.Post("/", supplierController.CreateSupplier)
+		suppliers.Get("/", supplierController.GetAllSuppliers)
+		suppliers.Get("/:id", supplierController.GetSupplier)
+		suppliers.Put("/:id", supplierController.UpdateSupplier)
+		suppliers.Delete("/:id", supplierController.DeleteSupplier)
+	}
+
+	// Purchase order routes
+	purchaseOrders := app.Group("/purchase-orders")
+	{
+		purchaseOrders.Post("/", supplierController.CreatePurchaseOrder)
+		purchaseOrders.Get("/", supplierController.GetAllPurchaseOrders)
+		purchaseOrders.Post("/from-reorder", supplierController.CreatePurchaseOrdersFromReorderBill)
+		purchaseOrders.Get("/:id", supplierController.GetPurchaseOrder)
+		purchaseOrders.Post("/:id/place", supplierController.PlacePurchaseOrder)
+		purchaseOrders.Post("/:id/cancel", supplierController.CancelPurchaseOrder)
+		purchaseOrders.Post("/:id/receive", supplierController.ReceivePurchaseOrder)
+	}
+
 	// Patient routes
 	patientController := controllers.NewPatientController(db)
+	invoiceController := controllers.NewInvoiceController(db)
+	paymentController := controllers.NewPaymentController(db)
 	patients := app.Group("/patients")
 	{
 		patients.Post("/", patientController.CreatePatient)
 		patients.Get("/", patientController.GetAllPatients)
+		patients.Get("/dues", paymentController.GetDuesAgeing)
 		patients.Get("/:id", patientController.GetPatient)
 		patients.Put("/:id", patientController.UpdatePatient)
 		patients.Delete("/:id", patientController.DeletePatient)
 		patients.Put("/undodelete/:id", patientController.UndoDeletePatient)
+		patients.Get("/:id/history", patientController.GetPatientHistory)
+		patients.Get("/:id/invoices", invoiceController.GetPatientInvoices)
+		patients.Post("/:id/payments", paymentController.RecordPatientPayment)
+		patients.Get("/:id/ledger", paymentController.GetPatientLedger)
 	}
+	admin.Post("/patients/:id/merge", patientController.MergePatient)
 
 	// Visit routes
 	visits := app.Group("/visits")
 	{
 		visits.Post("/", patientController.CreateVisit)
 		visits.Get("/", patientController.GetAllVisits)
+		visits.Get("/diagnoses", patientController.GetDiagnosedPatients)
+		visits.Get("/icd10-codes", patientController.SearchICD10Codes)
 		visits.Get("/:id", patientController.GetVisit)
 		visits.Put("/:id", patientController.UpdateVisit)
 		visits.Delete("/:id", patientController.DeleteVisit)
 		visits.Get("/patient/:id", patientController.GetAllVisitsByPatientID)
+
+		visits.Get("/:id/prescriptions", patientController.GetVisitPrescriptions)
+		visits.Put("/:id/prescriptions", patientController.UpdateVisitPrescriptions)
+		visits.Delete("/:id/prescriptions", patientController.CancelVisitPrescriptions)
+		visits.Post("/:id/dispense", patientController.DispenseVisitPrescriptions)
+	}
+
+	// Invoice routes
+	invoices := app.Group("/invoices")
+	{
+		invoices.Post("/", invoiceController.CreateInvoice)
+		invoices.Get("/", invoiceController.GetAllInvoices)
+		invoices.Get("/tax-summary", invoiceController.GetTaxSummary)
+		invoices.Get("/:id", invoiceController.GetInvoice)
+		invoices.Put("/:id", invoiceController.UpdateInvoice)
+		invoices.Post("/:id/issue", invoiceController.IssueInvoice)
+		invoices.Post("/:id/cancel", invoiceController.CancelInvoice)
+		invoices.Post("/:id/payments", paymentController.RecordInvoicePayment)
+		invoices.Get("/:id/payments", paymentController.GetInvoicePayments)
+	}
+
+	// Payment routes
+	payments := app.Group("/payments")
+	{
+		payments.Post("/:id/void", paymentController.VoidPayment)
 	}
 }
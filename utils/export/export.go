@@ -0,0 +1,41 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WriteCSV sends the rows as a downloadable csv file.
+func WriteCSV(c *fiber.Ctx, filename string, header []string, rows [][]string) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	return c.Status(200).Send(buf.Bytes())
+}
+
+// WriteHTML renders data with the template and sends it as a printable page.
+func WriteHTML(c *fiber.Ctx, tmpl *template.Template, data interface{}) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Status(200).Send(buf.Bytes())
+}
+
+func Amount(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
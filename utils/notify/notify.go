@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notification is what gets pushed to staff when an alert is raised.
+type Notification struct {
+	ID         int       `json:"id"`
+	Type       string    `json:"type"`
+	MedicineID int       `json:"medicine_id"`
+	Message    string    `json:"message"`
+	RaisedAt   time.Time `json:"raised_at"`
+}
+
+// Notifier delivers notifications somewhere staff will see them.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// LogNotifier writes notifications to the application log.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(n Notification) error {
+	log.Printf("Alert %d [%s]: %s", n.ID, n.Type, n.Message)
+	return nil
+}
+
+// WebhookNotifier posts each notification as JSON to a URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *WebhookNotifier) Notify(n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.Client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// EmailNotifier mails each notification through an SMTP server without authentication,
+// like a local relay or a development stand-in such as MailHog.
+type EmailNotifier struct {
+	Addr string // host:port of the SMTP server
+	From string
+	To   []string
+}
+
+func (e *EmailNotifier) Notify(n Notification) error {
+	subject := "Alert: " + strings.ReplaceAll(n.Type, "_", " ")
+	msg := "From: " + e.From + "\r\n" +
+		"To: " + strings.Join(e.To, ", ") + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"\r\n" +
+		n.Message + "\r\n" +
+		"Raised at " + n.RaisedAt.Format("02 Jan 2006 15:04") + "\r\n"
+	return smtp.SendMail(e.Addr, nil, e.From, e.To, []byte(msg))
+}
+
+// Channel is a notifier with a name. Delivery through each channel is tracked on its own, so that a channel
+// that is down is retried without the channels that delivered sending the notification again.
+type Channel struct {
+	Name     string
+	Notifier Notifier
+}